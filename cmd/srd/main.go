@@ -1,17 +1,27 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/cli"
 )
 
-// Where to store files
-const dir = "/tmp"
-
 func main() {
-	err := cli.Run(dir)
+	err := cli.Run(cli.DefaultDataDir())
+
+	// Some commands report their own outcome and only need to set the exit code
+	var exitErr *cli.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
+
+	if errors.Is(err, cli.ErrCancelled) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(cli.ExitCodeCancelled)
+	}
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -2,6 +2,7 @@ package airac
 
 import (
 	"fmt"
+	"iter"
 	"regexp"
 	"strconv"
 	"time"
@@ -14,6 +15,13 @@ const AiracIntervalDays = 28
 
 var BaseAiracDate = time.Date(2021, time.January, 28, 0, 0, 0, 0, time.UTC)
 var AiracCycleRegexp = regexp.MustCompile(`^(\d{2})(\d{2})$`)
+var AiracCycleLongRegexp = regexp.MustCompile(`^(\d{4})-?(\d{2})$`)
+
+// MaxCyclesInYear is the most AIRAC cycles that can start in a year, 13 cycles is 364 days so some years have 14
+const MaxCyclesInYear = 14
+
+// twoDigitYearPivot decides the century of a two digit year, years below it are 20xx and the rest are 19xx
+const twoDigitYearPivot = 69
 
 var (
 	ErrInvalidAiracIdent = fmt.Errorf("invalid AIRAC cycle identifier")
@@ -43,13 +51,80 @@ func (c *AiracCycle) YearString() string {
 	return c.Ident[:2]
 }
 
+// Year returns the full year of the cycle, expanding the two digit year of the ident as CycleFromIdent does
+func (c *AiracCycle) Year() int {
+	year, _, _ := parseAiracIdent(c.Ident)
+	return year
+}
+
 func (c *AiracCycle) MonthString() string {
 	return c.Ident[2:]
 }
 
+// Compare returns -1 if the cycle starts before the other, 1 if it starts after it, and 0 if they are the same cycle
+func (c *AiracCycle) Compare(other *AiracCycle) int {
+	return c.Start.Compare(other.Start)
+}
+
+// Before returns whether the cycle starts before the other
+func (c *AiracCycle) Before(other *AiracCycle) bool {
+	return c.Compare(other) < 0
+}
+
+// After returns whether the cycle starts after the other
+func (c *AiracCycle) After(other *AiracCycle) bool {
+	return c.Compare(other) > 0
+}
+
+// Equal returns whether the cycles are the same
+func (c *AiracCycle) Equal(other *AiracCycle) bool {
+	return c.Compare(other) == 0
+}
+
+// Contains returns whether the date falls within the cycle
+func (c *AiracCycle) Contains(date time.Time) bool {
+	return !date.Before(c.Start) && date.Before(c.End)
+}
+
 // GetCurrentAirac returns the current AIRAC cycle
 func (a *Airac) CurrentCycle() *AiracCycle {
-	return a.nextAiracFromDate(a.previousAiracDayFromDate(a.currentDay()).Add(-time.Hour * 24))
+	return a.CycleForDate(a.clock.Now())
+}
+
+// PreviousCycle returns the previous AIRAC cycle
+func (a *Airac) PreviousCycle() *AiracCycle {
+	return a.PreviousCycleFrom(a.CurrentCycle())
+}
+
+// CycleForDate returns the AIRAC cycle in effect on a date
+func (a *Airac) CycleForDate(date time.Time) *AiracCycle {
+	return a.nextAiracFromDate(a.previousAiracDayFromDate(startOfDay(date)).Add(-time.Hour * 24))
+}
+
+// PreviousCycleFrom returns the AIRAC cycle before a cycle
+func (a *Airac) PreviousCycleFrom(cycle *AiracCycle) *AiracCycle {
+	return a.CycleForDate(cycle.Start.Add(-time.Hour * 24))
+}
+
+// CyclesBetween returns the AIRAC cycles in effect at any point between two dates, inclusive, in order
+func (a *Airac) CyclesBetween(from, to time.Time) iter.Seq[*AiracCycle] {
+	return func(yield func(*AiracCycle) bool) {
+		for cycle := a.CycleForDate(from); !cycle.Start.After(to); cycle = a.NextCycleFrom(cycle) {
+			if !yield(cycle) {
+				return
+			}
+		}
+	}
+}
+
+// CyclesInYear returns the AIRAC cycles that start in a year, in order
+func (a *Airac) CyclesInYear(year int) []*AiracCycle {
+	cycles := make([]*AiracCycle, 0, MaxCyclesInYear)
+	for cycle := a.nthCycleOfYear(year, 1); cycle.Start.Year() == year; cycle = a.NextCycleFrom(cycle) {
+		cycles = append(cycles, cycle)
+	}
+
+	return cycles
 }
 
 // NextCycle returns the next AIRAC cycle
@@ -62,26 +137,58 @@ func (a *Airac) NextCycleFrom(cycle *AiracCycle) *AiracCycle {
 	return a.nextAiracFromDate(cycle.Start)
 }
 
-// CycleFromIdent returns the AIRAC cycle from an identifier
+// CycleFromIdent returns the AIRAC cycle from an identifier, either YYNN or YYYYNN (optionally YYYY-NN).
+// Two digit years from 69 onwards are taken as 19xx and the rest as 20xx. The cycle number is checked against
+// the number of cycles that actually start in the year, which is 13 for most years and 14 for a few.
 func (a *Airac) CycleFromIdent(ident string) (*AiracCycle, error) {
-	matches := AiracCycleRegexp.FindStringSubmatch(ident)
-	if matches == nil {
-		return nil, ErrInvalidAiracIdent
+	year, cycle, err := parseAiracIdent(ident)
+	if err != nil {
+		return nil, err
 	}
 
-	// The cycle must be between 1 and 13, convert the string to an integer
-	cycle, _ := strconv.Atoi(matches[2])
-	if cycle < 1 || cycle > 13 {
-		return nil, ErrInvalidAiracIdent
+	if cycle < 1 || cycle > MaxCyclesInYear {
+		return nil, fmt.Errorf("%w: %v, cycle number must be between 01 and %02d", ErrInvalidAiracIdent, ident, MaxCyclesInYear)
 	}
 
-	// Convert the year to an integer
-	year, _ := strconv.Atoi(matches[1])
+	cyclesInYear := a.CycleCountInYear(year)
+	if cycle > cyclesInYear {
+		return nil, fmt.Errorf("%w: %v, %v only has %v cycles", ErrInvalidAiracIdent, ident, year, cyclesInYear)
+	}
 
-	// The full year is 2000 + the first two digits of the year
-	cycleYear := 2000 + year
+	return a.nthCycleOfYear(year, cycle), nil
+}
 
-	return a.nthCycleOfYear(cycleYear, cycle), nil
+// CycleCountInYear returns the number of AIRAC cycles that start in a year
+func (a *Airac) CycleCountInYear(year int) int {
+	return len(a.CyclesInYear(year))
+}
+
+// parseAiracIdent splits an identifier into its full year and cycle number
+func parseAiracIdent(ident string) (int, int, error) {
+	if matches := AiracCycleRegexp.FindStringSubmatch(ident); matches != nil {
+		year, _ := strconv.Atoi(matches[1])
+		cycle, _ := strconv.Atoi(matches[2])
+
+		return expandTwoDigitYear(year), cycle, nil
+	}
+
+	if matches := AiracCycleLongRegexp.FindStringSubmatch(ident); matches != nil {
+		year, _ := strconv.Atoi(matches[1])
+		cycle, _ := strconv.Atoi(matches[2])
+
+		return year, cycle, nil
+	}
+
+	return 0, 0, fmt.Errorf("%w: %q, expected YYNN or YYYYNN", ErrInvalidAiracIdent, ident)
+}
+
+// expandTwoDigitYear converts a two digit year into a full year
+func expandTwoDigitYear(year int) int {
+	if year < twoDigitYearPivot {
+		return 2000 + year
+	}
+
+	return 1900 + year
 }
 
 func (a *Airac) nthCycleOfYear(year, cycle int) *AiracCycle {
@@ -130,7 +237,7 @@ func (a *Airac) identFromStartDate(start time.Time) string {
 }
 
 func (a *Airac) nextAiracDateFromDate(date time.Time) time.Time {
-	daysIntoCycle := a.daysSinceBase(date) % AiracIntervalDays
+	daysIntoCycle := daysIntoCycle(a.daysSinceBase(date))
 	return date.Add(AiracInterval - (time.Duration(daysIntoCycle) * time.Hour * 24))
 }
 
@@ -143,8 +250,7 @@ func (a *Airac) firstAiracDateOfYear(start time.Time) time.Time {
 }
 
 func (a *Airac) previousAiracDayFromDate(date time.Time) time.Time {
-	daysSinceBase := a.daysSinceBase(date)
-	daysIntoCycle := daysSinceBase % AiracIntervalDays
+	daysIntoCycle := daysIntoCycle(a.daysSinceBase(date))
 
 	return date.Add(-time.Duration(daysIntoCycle) * time.Hour * 24)
 }
@@ -153,6 +259,12 @@ func (a *Airac) currentDay() time.Time {
 	return startOfDay(a.clock.Now())
 }
 
+// daysIntoCycle returns how many days into its cycle a day is, given the number of days since the base date.
+// Days before the base date are negative, so this has to wrap them round to the start of their cycle.
+func daysIntoCycle(daysSinceBase int) int {
+	return ((daysSinceBase % AiracIntervalDays) + AiracIntervalDays) % AiracIntervalDays
+}
+
 // formatAiracIdent formats the AIRAC cycle identifier
 // Its the last two digits of the year followed by the cycle number, which is padded with a leading zero
 // For example 2024 1st cycle would be 2401
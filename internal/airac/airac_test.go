@@ -1,6 +1,7 @@
 package airac
 
 import (
+	"strconv"
 	"testing"
 	"time"
 
@@ -392,6 +393,44 @@ func TestCycleFromIdent(t *testing.T) {
 			expected: nil,
 			err:      ErrInvalidAiracIdent,
 		},
+		{
+			name:     "cycle zero",
+			ident:    "2400",
+			expected: nil,
+			err:      ErrInvalidAiracIdent,
+		},
+		{
+			name:     "cycle number beyond any year",
+			ident:    "2015",
+			expected: nil,
+			err:      ErrInvalidAiracIdent,
+		},
+		{
+			name:  "four digit year",
+			ident: "202304",
+			expected: &AiracCycle{
+				Ident: "2304",
+				Start: time.Date(2023, time.April, 20, 0, 0, 0, 0, time.UTC),
+				End:   time.Date(2023, time.May, 18, 0, 0, 0, 0, time.UTC),
+			},
+			err: nil,
+		},
+		{
+			name:  "four digit year with separator",
+			ident: "2023-04",
+			expected: &AiracCycle{
+				Ident: "2304",
+				Start: time.Date(2023, time.April, 20, 0, 0, 0, 0, time.UTC),
+				End:   time.Date(2023, time.May, 18, 0, 0, 0, 0, time.UTC),
+			},
+			err: nil,
+		},
+		{
+			name:     "four digit year with invalid cycle number",
+			ident:    "202414",
+			expected: nil,
+			err:      ErrInvalidAiracIdent,
+		},
 	}
 
 	for _, tt := range tests {
@@ -399,12 +438,143 @@ func TestCycleFromIdent(t *testing.T) {
 			clock := clockLib.NewMock()
 			airac := NewAirac(clock)
 			actual, err := airac.CycleFromIdent(tt.ident)
-			require.Equal(t, tt.err, err)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
 			require.Equal(t, tt.expected, actual)
 		})
 	}
 }
 
+// Test CycleFromIdent across decades, including the years that have 14 cycles
+func TestCycleFromIdentAcrossDecades(t *testing.T) {
+	tests := []struct {
+		name          string
+		ident         string
+		expectedIdent string
+		expectedStart time.Time
+		expectedErr   string
+	}{
+		{
+			name:          "first cycle of 1976",
+			ident:         "7601",
+			expectedIdent: "7601",
+			expectedStart: time.Date(1976, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "fourteenth cycle of 1976",
+			ident:         "7614",
+			expectedIdent: "7614",
+			expectedStart: time.Date(1976, time.December, 30, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "fourteenth cycle of 1985 does not exist",
+			ident:       "8514",
+			expectedErr: "invalid AIRAC cycle identifier: 8514, 1985 only has 13 cycles",
+		},
+		{
+			name:          "fourteenth cycle of 1998",
+			ident:         "9814",
+			expectedIdent: "9814",
+			expectedStart: time.Date(1998, time.December, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "first cycle of 1999",
+			ident:         "9901",
+			expectedIdent: "9901",
+			expectedStart: time.Date(1999, time.January, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "thirteenth cycle of 2009",
+			ident:         "0913",
+			expectedIdent: "0913",
+			expectedStart: time.Date(2009, time.December, 17, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "fourteenth cycle of 2009 does not exist",
+			ident:       "0914",
+			expectedErr: "invalid AIRAC cycle identifier: 0914, 2009 only has 13 cycles",
+		},
+		{
+			name:          "fourteenth cycle of 2020",
+			ident:         "2014",
+			expectedIdent: "2014",
+			expectedStart: time.Date(2020, time.December, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "first cycle of 2021 follows the fourteenth cycle of 2020",
+			ident:         "2101",
+			expectedIdent: "2101",
+			expectedStart: time.Date(2021, time.January, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "fourteenth cycle of 2035 does not exist",
+			ident:       "203514",
+			expectedErr: "invalid AIRAC cycle identifier: 203514, 2035 only has 13 cycles",
+		},
+		{
+			name:          "fourteenth cycle of 2043",
+			ident:         "204314",
+			expectedIdent: "4314",
+			expectedStart: time.Date(2043, time.December, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "cycle number out of range",
+			ident:       "2099",
+			expectedErr: "invalid AIRAC cycle identifier: 2099, cycle number must be between 01 and 14",
+		},
+		{
+			name:        "invalid format",
+			ident:       "24-1",
+			expectedErr: `invalid AIRAC cycle identifier: "24-1", expected YYNN or YYYYNN`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			airac := NewAirac(clockLib.NewMock())
+			actual, err := airac.CycleFromIdent(tt.ident)
+			if tt.expectedErr != "" {
+				require.ErrorIs(t, err, ErrInvalidAiracIdent)
+				require.EqualError(t, err, tt.expectedErr)
+				require.Nil(t, actual)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedIdent, actual.Ident)
+			require.Equal(t, tt.expectedStart, actual.Start)
+			require.Equal(t, tt.expectedStart.AddDate(0, 0, AiracIntervalDays), actual.End)
+		})
+	}
+}
+
+// Test the CycleCountInYear method
+func TestCycleCountInYear(t *testing.T) {
+	tests := []struct {
+		year     int
+		expected int
+	}{
+		{year: 1976, expected: 14},
+		{year: 1990, expected: 13},
+		{year: 1998, expected: 14},
+		{year: 2010, expected: 13},
+		{year: 2020, expected: 14},
+		{year: 2021, expected: 13},
+		{year: 2024, expected: 13},
+		{year: 2043, expected: 14},
+		{year: 2065, expected: 14},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.year), func(t *testing.T) {
+			require.Equal(t, tt.expected, NewAirac(clockLib.NewMock()).CycleCountInYear(tt.year))
+		})
+	}
+}
+
 // Test the YearString method
 func TestAiracCycleYearString(t *testing.T) {
 	tests := []struct {
@@ -449,6 +619,27 @@ func TestAiracCycleYearString(t *testing.T) {
 	}
 }
 
+// Test the Year method
+func TestAiracCycleYear(t *testing.T) {
+	tests := []struct {
+		ident    string
+		expected int
+	}{
+		{ident: "2401", expected: 2024},
+		{ident: "2413", expected: 2024},
+		{ident: "6901", expected: 1969},
+		{ident: "9901", expected: 1999},
+		{ident: "6801", expected: 2068},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ident, func(t *testing.T) {
+			cycle := &AiracCycle{Ident: tt.ident}
+			require.Equal(t, tt.expected, cycle.Year())
+		})
+	}
+}
+
 // Test the MonthString method
 func TestAiracCycleMonthString(t *testing.T) {
 	tests := []struct {
@@ -493,6 +684,207 @@ func TestAiracCycleMonthString(t *testing.T) {
 	}
 }
 
+// Test the CycleForDate method
+func TestCycleForDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		date     time.Time
+		expected string
+	}{
+		{"first day of cycle", time.Date(2024, time.January, 25, 0, 0, 0, 0, time.UTC), "2401"},
+		{"last second of cycle", time.Date(2024, time.February, 21, 23, 59, 59, 0, time.UTC), "2401"},
+		{"mid cycle", time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC), "2502"},
+		{"new year in last cycle", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), "2413"},
+		{"base date", BaseAiracDate, "2101"},
+		{"before base date", time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC), "2006"},
+		{"fourteenth cycle", time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), "2014"},
+		{"long ago", time.Date(1998, time.January, 1, 0, 0, 0, 0, time.UTC), "9801"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The clock shouldn't matter for a specific date
+			clock := clockLib.NewMock()
+			clock.Set(time.Date(2030, time.June, 1, 0, 0, 0, 0, time.UTC))
+
+			actual := NewAirac(clock).CycleForDate(tt.date)
+			require.Equal(t, tt.expected, actual.Ident)
+			require.True(t, actual.Contains(tt.date))
+			require.Equal(t, AiracInterval, actual.End.Sub(actual.Start))
+		})
+	}
+}
+
+// Test the PreviousCycle and PreviousCycleFrom methods
+func TestPreviousCycleFrom(t *testing.T) {
+	tests := []struct {
+		name     string
+		ident    string
+		expected *AiracCycle
+	}{
+		{
+			name:  "mid year",
+			ident: "2407",
+			expected: &AiracCycle{
+				Ident: "2406",
+				Start: time.Date(2024, time.June, 13, 0, 0, 0, 0, time.UTC),
+				End:   time.Date(2024, time.July, 11, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "first cycle of the year",
+			ident: "2501",
+			expected: &AiracCycle{
+				Ident: "2413",
+				Start: time.Date(2024, time.December, 26, 0, 0, 0, 0, time.UTC),
+				End:   time.Date(2025, time.January, 23, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "after a fourteen cycle year",
+			ident: "2101",
+			expected: &AiracCycle{
+				Ident: "2014",
+				Start: time.Date(2020, time.December, 31, 0, 0, 0, 0, time.UTC),
+				End:   time.Date(2021, time.January, 28, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			airac := NewAirac(clockLib.NewMock())
+			cycle, err := airac.CycleFromIdent(tt.ident)
+			require.NoError(t, err)
+
+			actual := airac.PreviousCycleFrom(cycle)
+			require.Equal(t, tt.expected, actual)
+			require.Equal(t, cycle.Ident, airac.NextCycleFrom(actual).Ident)
+		})
+	}
+}
+
+func TestPreviousCycle(t *testing.T) {
+	clock := clockLib.NewMock()
+	clock.Set(time.Date(2024, time.September, 6, 0, 0, 0, 0, time.UTC))
+
+	require.Equal(t, "2408", NewAirac(clock).PreviousCycle().Ident)
+}
+
+// Test the CyclesBetween method
+func TestCyclesBetween(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     time.Time
+		to       time.Time
+		expected []string
+	}{
+		{
+			name:     "within a single cycle",
+			from:     time.Date(2024, time.September, 6, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2024, time.September, 20, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2409"},
+		},
+		{
+			name:     "across the new year",
+			from:     time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2412", "2413", "2501"},
+		},
+		{
+			name:     "to is the first day of a cycle",
+			from:     time.Date(2024, time.September, 5, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2024, time.October, 3, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2409", "2410"},
+		},
+		{
+			name:     "to before from",
+			from:     time.Date(2024, time.October, 3, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2024, time.September, 5, 0, 0, 0, 0, time.UTC),
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := make([]string, 0)
+			for cycle := range NewAirac(clockLib.NewMock()).CyclesBetween(tt.from, tt.to) {
+				actual = append(actual, cycle.Ident)
+			}
+
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestCyclesBetween_StopsEarly(t *testing.T) {
+	airac := NewAirac(clockLib.NewMock())
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	actual := make([]string, 0)
+	for cycle := range airac.CyclesBetween(from, to) {
+		actual = append(actual, cycle.Ident)
+		if len(actual) == 2 {
+			break
+		}
+	}
+
+	require.Equal(t, []string{"2313", "2401"}, actual)
+}
+
+// Test the CyclesInYear method
+func TestCyclesInYear(t *testing.T) {
+	tests := []struct {
+		name          string
+		year          int
+		expectedCount int
+		expectedFirst time.Time
+		expectedLast  time.Time
+	}{
+		{"2024", 2024, 13, time.Date(2024, time.January, 25, 0, 0, 0, 0, time.UTC), time.Date(2024, time.December, 26, 0, 0, 0, 0, time.UTC)},
+		{"2020 has fourteen cycles", 2020, 14, time.Date(2020, time.January, 2, 0, 0, 0, 0, time.UTC), time.Date(2020, time.December, 31, 0, 0, 0, 0, time.UTC)},
+		{"2021", 2021, 13, time.Date(2021, time.January, 28, 0, 0, 0, 0, time.UTC), time.Date(2021, time.December, 30, 0, 0, 0, 0, time.UTC)},
+		{"2026", 2026, 13, time.Date(2026, time.January, 22, 0, 0, 0, 0, time.UTC), time.Date(2026, time.December, 24, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cycles := NewAirac(clockLib.NewMock()).CyclesInYear(tt.year)
+			require.Len(t, cycles, tt.expectedCount)
+			require.Equal(t, tt.expectedFirst, cycles[0].Start)
+			require.Equal(t, tt.expectedLast, cycles[len(cycles)-1].Start)
+
+			for i, cycle := range cycles {
+				require.Equal(t, formatAiracIdent(i+1, tt.year), cycle.Ident)
+			}
+		})
+	}
+}
+
+// Test the comparison methods on AiracCycle
+func TestAiracCycleComparisons(t *testing.T) {
+	airac := NewAirac(clockLib.NewMock())
+	earlier, _ := airac.CycleFromIdent("2412")
+	later, _ := airac.CycleFromIdent("2501")
+	sameAsLater, _ := airac.CycleFromIdent("2501")
+
+	require.Equal(t, -1, earlier.Compare(later))
+	require.Equal(t, 1, later.Compare(earlier))
+	require.Equal(t, 0, later.Compare(sameAsLater))
+
+	require.True(t, earlier.Before(later))
+	require.False(t, later.Before(earlier))
+	require.True(t, later.After(earlier))
+	require.False(t, earlier.After(later))
+	require.True(t, later.Equal(sameAsLater))
+	require.False(t, later.Equal(earlier))
+
+	require.True(t, later.Contains(later.Start))
+	require.False(t, later.Contains(later.End))
+	require.False(t, later.Contains(earlier.Start))
+}
+
 func BenchmarkCurrentAiracCycle(b *testing.B) {
 	clock := clockLib.NewMock()
 	airac := NewAirac(clock)
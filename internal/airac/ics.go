@@ -0,0 +1,52 @@
+package airac
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// icsDateFormat and icsTimestampFormat are the RFC 5545 DATE and UTC DATE-TIME formats
+const (
+	icsDateFormat      = "20060102"
+	icsTimestampFormat = "20060102T150405Z"
+)
+
+// WriteICalendar writes an RFC 5545 calendar with an all day event on the effective date of each cycle.
+// The stamp is used as the DTSTAMP of each event, and UIDs are stable so re-importing updates existing events.
+func WriteICalendar(w io.Writer, cycles []*AiracCycle, stamp time.Time) error {
+	bw := bufio.NewWriter(w)
+	line := func(format string, args ...any) {
+		// RFC 5545 requires CRLF line endings
+		fmt.Fprintf(bw, format+"\r\n", args...)
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//VATSIM UK//UKCP SRD Tools//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:AIRAC Cycles")
+
+	for _, cycle := range cycles {
+		line("BEGIN:VEVENT")
+		line("UID:airac-%s@ukcp-srd-tools.vatsim.uk", cycle.Ident)
+		line("DTSTAMP:%s", stamp.UTC().Format(icsTimestampFormat))
+		line("DTSTART;VALUE=DATE:%s", cycle.Start.Format(icsDateFormat))
+		line("DTEND;VALUE=DATE:%s", cycle.Start.AddDate(0, 0, 1).Format(icsDateFormat))
+		line("SUMMARY:AIRAC %s effective", cycle.Ident)
+		line(
+			"DESCRIPTION:AIRAC cycle %s is effective from %s until %s.",
+			cycle.Ident,
+			cycle.Start.Format("2006-01-02"),
+			cycle.End.Format("2006-01-02"),
+		)
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+
+	return bw.Flush()
+}
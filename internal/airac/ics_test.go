@@ -0,0 +1,64 @@
+package airac
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	clockLib "github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteICalendar(t *testing.T) {
+	require := require.New(t)
+	airac := NewAirac(clockLib.NewMock())
+	first, _ := airac.CycleFromIdent("2413")
+	second, _ := airac.CycleFromIdent("2501")
+
+	buf := new(bytes.Buffer)
+	stamp := time.Date(2024, time.December, 1, 12, 30, 0, 0, time.UTC)
+	require.NoError(WriteICalendar(buf, []*AiracCycle{first, second}, stamp))
+
+	expected := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//VATSIM UK//UKCP SRD Tools//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:AIRAC Cycles",
+		"BEGIN:VEVENT",
+		"UID:airac-2413@ukcp-srd-tools.vatsim.uk",
+		"DTSTAMP:20241201T123000Z",
+		"DTSTART;VALUE=DATE:20241226",
+		"DTEND;VALUE=DATE:20241227",
+		"SUMMARY:AIRAC 2413 effective",
+		"DESCRIPTION:AIRAC cycle 2413 is effective from 2024-12-26 until 2025-01-23.",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:airac-2501@ukcp-srd-tools.vatsim.uk",
+		"DTSTAMP:20241201T123000Z",
+		"DTSTART;VALUE=DATE:20250123",
+		"DTEND;VALUE=DATE:20250124",
+		"SUMMARY:AIRAC 2501 effective",
+		"DESCRIPTION:AIRAC cycle 2501 is effective from 2025-01-23 until 2025-02-20.",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+
+	require.Equal(strings.Join(expected, "\r\n")+"\r\n", buf.String())
+
+	// RFC 5545 lines should be no longer than 75 octets
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		require.LessOrEqual(len(line), 75, line)
+	}
+}
+
+func TestWriteICalendar_NoCycles(t *testing.T) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, WriteICalendar(buf, []*AiracCycle{}, time.Now()))
+	require.NotContains(t, buf.String(), "BEGIN:VEVENT")
+	require.True(t, strings.HasSuffix(buf.String(), "END:VCALENDAR\r\n"))
+}
@@ -1,69 +1,181 @@
 package airac
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 )
 
+// loadedCycleFileName is the name of the file in the data directory that records the loaded cycle
+const loadedCycleFileName = "ukcp-srd-import-loaded-cycle"
+
+// LoadedState is everything recorded about the SRD that was last imported.
+// Files written by older versions only contain the ident, so any other field may be empty.
+type LoadedState struct {
+	Ident string `json:"ident"`
+
+	// When the import finished
+	ImportedAt time.Time `json:"imported_at"`
+
+	// The file that was imported, its SHA-256 checksum, and where it was downloaded from if it was
+	SourceFile     string `json:"source_file,omitempty"`
+	SourceChecksum string `json:"source_checksum,omitempty"`
+	SourceUrl      string `json:"source_url,omitempty"`
+
+	// Counts of what was processed from the file
+	RouteCount      int `json:"route_count"`
+	RouteErrorCount int `json:"route_error_count"`
+	NoteCount       int `json:"note_count"`
+	NoteErrorCount  int `json:"note_error_count"`
+
+	// The version of the tool that performed the import
+	ToolVersion string `json:"tool_version,omitempty"`
+}
+
+// LoadedStateSource is somewhere other than the local file that records the loaded cycle, such as the database
+type LoadedStateSource interface {
+	// LoadedState returns the recorded state, and false if nothing has been recorded
+	LoadedState(ctx context.Context) (LoadedState, bool, error)
+}
+
 type LoadedAirac struct {
-	ident string
+	state LoadedState
 
-	loadedCycleFile *os.File
+	// Where the state was read from, the local file unless replaced by another source
+	source string
+
+	path   string
+	closed bool
 }
 
 func NewLoadedAirac(dir string) (*LoadedAirac, error) {
-	loadedCycleFile, err := loadCycleFile(dir)
-	if err != nil {
+	path := filePath(dir, loadedCycleFileName)
+
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("failed to load loaded cycle file: %w", err)
 	}
 
-	// Scan the file for the loaded cycle
-	scanner := bufio.NewScanner(loadedCycleFile)
-	scanner.Split(bufio.ScanWords)
-
-	scanner.Scan()
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to scan loaded cycle file: %w", err)
+	state, err := parseLoadedState(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse loaded cycle file: %w", err)
 	}
 
 	return &LoadedAirac{
-		ident:           scanner.Text(),
-		loadedCycleFile: loadedCycleFile,
+		state:  state,
+		source: path,
+		path:   path,
 	}, nil
 }
 
+// LoadFrom replaces the state read from the local file with the state recorded by another source, if it has one.
+// The local file isn't changed until the state is next set.
+func (l *LoadedAirac) LoadFrom(ctx context.Context, name string, source LoadedStateSource) (bool, error) {
+	state, ok, err := source.LoadedState(ctx)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	l.state = state
+	l.source = name
+	return true, nil
+}
+
+// Source describes where the loaded state was read from
+func (l *LoadedAirac) Source() string {
+	return l.source
+}
+
 func (l *LoadedAirac) Ident() string {
-	return l.ident
+	return l.state.Ident
 }
 
 func (l *LoadedAirac) Is(ident string) bool {
-	return l.ident == ident
+	return l.state.Ident == ident
+}
+
+// State returns everything recorded about the loaded cycle
+func (l *LoadedAirac) State() LoadedState {
+	return l.state
 }
 
 func (l *LoadedAirac) Close() error {
-	return l.loadedCycleFile.Close()
+	if l.closed {
+		return os.ErrClosed
+	}
+
+	l.closed = true
+	return nil
 }
 
+// Set records the cycle as loaded, without any details of the import
 func (l *LoadedAirac) Set(cycle *AiracCycle) error {
-	_, err := l.loadedCycleFile.Seek(0, 0)
+	return l.SetState(LoadedState{Ident: cycle.Ident})
+}
+
+// SetState records the state of the loaded cycle. The file is written in full to a temporary file and then
+// renamed into place, so a crash part way through leaves the previous state intact.
+func (l *LoadedAirac) SetState(state LoadedState) error {
+	if l.closed {
+		return os.ErrClosed
+	}
+
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode loaded cycle: %w", err)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(l.path), loadedCycleFileName+"-*.tmp")
 	if err != nil {
-		return fmt.Errorf("failed to seek loaded cycle file: %w", err)
+		return fmt.Errorf("failed to create temporary loaded cycle file: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(append(content, '\n'))
+	if err == nil {
+		err = tempFile.Sync()
+	}
+
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
 	}
 
-	err = l.loadedCycleFile.Truncate(0)
 	if err != nil {
-		return fmt.Errorf("failed to truncate loaded cycle file: %w", err)
+		return fmt.Errorf("failed to write temporary loaded cycle file: %w", err)
 	}
 
-	_, err = l.loadedCycleFile.WriteString(cycle.Ident)
-	return err
+	err = os.Rename(tempFile.Name(), l.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace loaded cycle file: %w", err)
+	}
+
+	l.state = state
+	return nil
 }
 
-func filePath(dir, file string) string {
-	return fmt.Sprintf("%s/%s", dir, file)
+// parseLoadedState reads the loaded cycle file, which is either JSON or, in the old format, a bare ident
+func parseLoadedState(content []byte) (LoadedState, error) {
+	content = bytes.TrimSpace(content)
+
+	state := LoadedState{}
+	if len(content) == 0 {
+		return state, nil
+	}
+
+	if content[0] != '{' {
+		fields := bytes.Fields(content)
+		state.Ident = string(fields[0])
+		return state, nil
+	}
+
+	err := json.Unmarshal(content, &state)
+	return state, err
 }
 
-func loadCycleFile(dir string) (*os.File, error) {
-	return os.OpenFile(filePath(dir, "ukcp-srd-import-loaded-cycle"), os.O_RDWR|os.O_CREATE, 0600)
+func filePath(dir, file string) string {
+	return fmt.Sprintf("%s/%s", dir, file)
 }
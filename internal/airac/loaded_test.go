@@ -2,8 +2,10 @@ package airac
 
 import (
 	"bufio"
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -12,7 +14,7 @@ func TestNewLoadedAirac(t *testing.T) {
 	testDir := t.TempDir()
 
 	// Create a temporary file with a test cycle ident
-	filePath := filePath(testDir, "ukcp-srd-import-loaded-cycle")
+	filePath := filePath(testDir, loadedCycleFileName)
 	file, err := os.Create(filePath)
 	require.NoError(t, err, "Failed to create temp file")
 	writer := bufio.NewWriter(file)
@@ -65,7 +67,7 @@ func TestLoadedAirac_Is(t *testing.T) {
 	testDir := t.TempDir()
 
 	// Create a temporary file with a test cycle ident
-	filePath := filePath(testDir, "ukcp-srd-import-loaded-cycle")
+	filePath := filePath(testDir, loadedCycleFileName)
 	file, err := os.Create(filePath)
 	require.NoError(t, err, "Failed to create temp file")
 	writer := bufio.NewWriter(file)
@@ -81,3 +83,194 @@ func TestLoadedAirac_Is(t *testing.T) {
 	require.True(t, loadedAirac.Is("test_cycle"), "Expected Is to return true for ident 'test_cycle'")
 	require.False(t, loadedAirac.Is("wrong_cycle"), "Expected Is to return false for ident 'wrong_cycle'")
 }
+
+func TestLoadedAirac_SetState(t *testing.T) {
+	testDir := t.TempDir()
+
+	loadedAirac, err := NewLoadedAirac(testDir)
+	require.NoError(t, err, "NewLoadedAirac returned an error")
+	require.Equal(t, LoadedState{}, loadedAirac.State())
+
+	state := LoadedState{
+		Ident:           "2501",
+		ImportedAt:      time.Date(2025, time.January, 23, 1, 2, 3, 0, time.UTC),
+		SourceFile:      "/tmp/srd.xlsx",
+		SourceChecksum:  "abc123",
+		SourceUrl:       "https://example.com/srd.zip",
+		RouteCount:      100,
+		RouteErrorCount: 1,
+		NoteCount:       10,
+		NoteErrorCount:  2,
+		ToolVersion:     "v1.2.3",
+	}
+	require.NoError(t, loadedAirac.SetState(state))
+	require.Equal(t, state, loadedAirac.State())
+	require.NoError(t, loadedAirac.Close())
+
+	// Reopen the file to check the new content
+	loadedAirac, err = NewLoadedAirac(testDir)
+	require.NoError(t, err, "NewLoadedAirac returned an error")
+	defer loadedAirac.Close()
+
+	require.Equal(t, state, loadedAirac.State())
+	require.True(t, loadedAirac.Is("2501"))
+
+	// Only the state file should be left behind
+	entries, err := os.ReadDir(testDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, loadedCycleFileName, entries[0].Name())
+}
+
+func TestLoadedAirac_SetStateAfterClose(t *testing.T) {
+	loadedAirac, err := NewLoadedAirac(t.TempDir())
+	require.NoError(t, err, "NewLoadedAirac returned an error")
+	require.NoError(t, loadedAirac.Close())
+
+	require.ErrorIs(t, loadedAirac.Set(NewAirac(nil).CurrentCycle()), os.ErrClosed)
+}
+
+func TestLoadedAirac_SetStateLeavesPreviousStateOnFailure(t *testing.T) {
+	testDir := t.TempDir()
+
+	loadedAirac, err := NewLoadedAirac(testDir)
+	require.NoError(t, err, "NewLoadedAirac returned an error")
+	defer loadedAirac.Close()
+	require.NoError(t, loadedAirac.SetState(LoadedState{Ident: "2501"}))
+
+	// Replace the file with a directory, so the rename fails
+	path := filePath(testDir, loadedCycleFileName)
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.Mkdir(path, 0700))
+	require.NoError(t, os.WriteFile(filePath(path, "keep"), []byte("keep"), 0600))
+
+	require.Error(t, loadedAirac.SetState(LoadedState{Ident: "2502"}))
+	require.Equal(t, "2501", loadedAirac.Ident())
+
+	// No temporary files should be left behind
+	entries, err := os.ReadDir(testDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestParseLoadedState(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected LoadedState
+		err      bool
+	}{
+		{
+			name:     "empty file",
+			content:  "",
+			expected: LoadedState{},
+		},
+		{
+			name:     "old format",
+			content:  "2403",
+			expected: LoadedState{Ident: "2403"},
+		},
+		{
+			name:     "old format with trailing newline",
+			content:  "2403\n",
+			expected: LoadedState{Ident: "2403"},
+		},
+		{
+			name:    "json",
+			content: `{"ident": "2403", "imported_at": "2024-03-21T10:00:00Z", "route_count": 5, "tool_version": "v1.0.0"}`,
+			expected: LoadedState{
+				Ident:       "2403",
+				ImportedAt:  time.Date(2024, time.March, 21, 10, 0, 0, 0, time.UTC),
+				RouteCount:  5,
+				ToolVersion: "v1.0.0",
+			},
+		},
+		{
+			name:    "invalid json",
+			content: `{"ident": `,
+			err:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := parseLoadedState([]byte(tt.content))
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+type mockLoadedStateSource struct {
+	state LoadedState
+	found bool
+	err   error
+}
+
+func (m *mockLoadedStateSource) LoadedState(ctx context.Context) (LoadedState, bool, error) {
+	return m.state, m.found, m.err
+}
+
+func TestLoadedAirac_LoadFrom(t *testing.T) {
+	tests := []struct {
+		name           string
+		source         *mockLoadedStateSource
+		expectedFound  bool
+		expectedErr    error
+		expectedIdent  string
+		expectedSource string
+	}{
+		{
+			name:           "source has a state",
+			source:         &mockLoadedStateSource{state: LoadedState{Ident: "2502"}, found: true},
+			expectedFound:  true,
+			expectedIdent:  "2502",
+			expectedSource: "database",
+		},
+		{
+			name:           "source has no state",
+			source:         &mockLoadedStateSource{},
+			expectedIdent:  "2501",
+			expectedSource: "file",
+		},
+		{
+			name:           "source errors",
+			source:         &mockLoadedStateSource{err: os.ErrPermission},
+			expectedErr:    os.ErrPermission,
+			expectedIdent:  "2501",
+			expectedSource: "file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir := t.TempDir()
+			require.NoError(t, os.WriteFile(filePath(testDir, loadedCycleFileName), []byte("2501"), 0600))
+
+			loadedAirac, err := NewLoadedAirac(testDir)
+			require.NoError(t, err, "NewLoadedAirac returned an error")
+			defer loadedAirac.Close()
+
+			found, err := loadedAirac.LoadFrom(context.Background(), "database", tt.source)
+			require.ErrorIs(t, err, tt.expectedErr)
+			require.Equal(t, tt.expectedFound, found)
+			require.Equal(t, tt.expectedIdent, loadedAirac.Ident())
+
+			if tt.expectedSource == "file" {
+				require.Equal(t, filePath(testDir, loadedCycleFileName), loadedAirac.Source())
+			} else {
+				require.Equal(t, tt.expectedSource, loadedAirac.Source())
+			}
+
+			// The local file is left alone
+			content, err := os.ReadFile(filePath(testDir, loadedCycleFileName))
+			require.NoError(t, err)
+			require.Equal(t, "2501", string(content))
+		})
+	}
+}
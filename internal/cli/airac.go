@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	clockLib "github.com/benbjohnson/clock"
+	"github.com/rs/zerolog/log"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+)
+
+// airacCycleJson is how an AIRAC cycle is presented in JSON output
+type airacCycleJson struct {
+	Ident string `json:"ident"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+func newAiracCycleJson(cycle *airac.AiracCycle) airacCycleJson {
+	return airacCycleJson{
+		Ident: cycle.Ident,
+		Start: cycle.Start.Format("2006-01-02"),
+		End:   cycle.End.Format("2006-01-02"),
+	}
+}
+
+// doAirac gets information about the current AIRAC cycle, or the cycle in effect on a given date
+func doAirac(clock clockLib.Clock, date string, format string) error {
+	airacManager := airac.NewAirac(clock)
+
+	cycleName := "Current"
+	cycle := airacManager.CurrentCycle()
+	if date != "" {
+		day, err := parseDate(date)
+		if err != nil {
+			return err
+		}
+
+		cycleName = "On " + day.Format("2006-01-02")
+		cycle = airacManager.CycleForDate(day)
+	}
+
+	nextCycle := airacManager.NextCycleFrom(cycle)
+
+	if format == "json" {
+		return writeJson(map[string]airacCycleJson{
+			"cycle": newAiracCycleJson(cycle),
+			"next":  newAiracCycleJson(nextCycle),
+		})
+	}
+
+	table := newAiracTable("CYCLE")
+	table.row(cycle, cycleName)
+	table.row(nextCycle, "Next")
+
+	return table.Flush()
+}
+
+// doAiracList lists the AIRAC cycles in a year, defaulting to the current year
+func doAiracList(clock clockLib.Clock, year int, format string) error {
+	airacManager := airac.NewAirac(clock)
+	if year == 0 {
+		year = airacManager.CurrentCycle().Start.Year()
+	}
+
+	cycles := airacManager.CyclesInYear(year)
+
+	if format == "json" {
+		cyclesJson := make([]airacCycleJson, 0, len(cycles))
+		for _, cycle := range cycles {
+			cyclesJson = append(cyclesJson, newAiracCycleJson(cycle))
+		}
+
+		return writeJson(cyclesJson)
+	}
+
+	table := newAiracTable()
+	for _, cycle := range cycles {
+		table.row(cycle)
+	}
+
+	return table.Flush()
+}
+
+// airacTable writes AIRAC cycles to stdout as a table, with the ident, start and end dates after any leading columns
+type airacTable struct {
+	*tabwriter.Writer
+}
+
+func newAiracTable(leadingColumns ...string) airacTable {
+	table := airacTable{tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)}
+	for _, column := range leadingColumns {
+		fmt.Fprintf(table, "%v\t", column)
+	}
+
+	fmt.Fprintln(table, "IDENT\tSTART\tEND")
+	return table
+}
+
+func (t airacTable) row(cycle *airac.AiracCycle, leading ...string) {
+	for _, value := range leading {
+		fmt.Fprintf(t, "%v\t", value)
+	}
+
+	fmt.Fprintf(t, "%v\t%v\t%v\n", cycle.Ident, cycle.Start.Format("2006-01-02"), cycle.End.Format("2006-01-02"))
+}
+
+// doAiracIcs writes an iCalendar of the AIRAC cycle start dates to stdout, defaulting to this year and next
+func doAiracIcs(clock clockLib.Clock, years []int) error {
+	airacManager := airac.NewAirac(clock)
+	if len(years) == 0 {
+		currentYear := airacManager.CurrentCycle().Start.Year()
+		years = []int{currentYear, currentYear + 1}
+	}
+
+	cycles := make([]*airac.AiracCycle, 0)
+	for _, year := range years {
+		cycles = append(cycles, airacManager.CyclesInYear(year)...)
+	}
+
+	log.Debug().Msgf("Writing iCalendar of %v AIRAC cycles", len(cycles))
+	return airac.WriteICalendar(os.Stdout, cycles, clock.Now())
+}
+
+func logAiracCycle(description string, cycle *airac.AiracCycle) {
+	log.Info().Msgf(
+		"%v is %v (%v - %v)",
+		description,
+		cycle.Ident,
+		cycle.Start.Format("2006-01-02"),
+		cycle.End.Format("2006-01-02"),
+	)
+}
+
+// writeJson writes a value to stdout as indented JSON
+func writeJson(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// parseDate parses a date given on the command line
+func parseDate(date string) (time.Time, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid date %v", date)
+		return time.Time{}, ErrInvalidDate
+	}
+
+	return day, nil
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	clockLib "github.com/benbjohnson/clock"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/download"
+)
+
+// checkStatus is the result of a check, its value is the Nagios plugin exit code
+type checkStatus int
+
+const (
+	checkOk checkStatus = iota
+	checkWarning
+	checkCritical
+	checkUnknown
+)
+
+func (s checkStatus) String() string {
+	switch s {
+	case checkOk:
+		return "OK"
+	case checkWarning:
+		return "WARNING"
+	case checkCritical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ExitError is returned when a command has already reported its outcome and only needs to set the exit code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// checkResult is the outcome of checking the loaded SRD, and how it is presented in JSON output
+type checkResult struct {
+	Status        string          `json:"status"`
+	Code          int             `json:"code"`
+	Message       string          `json:"message"`
+	Loaded        *airacCycleJson `json:"loaded"`
+	Current       airacCycleJson  `json:"current"`
+	Next          airacCycleJson  `json:"next"`
+	NextStaged    bool            `json:"next_staged"`
+	DaysUntilNext int             `json:"days_until_next"`
+
+	status checkStatus
+}
+
+// doCheck compares the loaded AIRAC cycle with the current one, and exits with a Nagios style status:
+// OK when the loaded cycle is current, WARNING when the next cycle starts within warnDays and hasn't been staged,
+// CRITICAL when the loaded cycle is out of date, and UNKNOWN when the loaded cycle can't be read.
+func doCheck(ctx context.Context, clock clockLib.Clock, warnDays int, format string, envPath string, dir string) error {
+	result := checkLoaded(ctx, clock, warnDays, envPath, dir)
+
+	if format == "json" {
+		if err := writeJson(result); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(os.Stdout, "SRD %v - %v | days_until_next=%d;%d\n", result.Status, result.Message, result.DaysUntilNext, warnDays)
+	}
+
+	if result.status == checkOk {
+		return nil
+	}
+
+	return &ExitError{Code: int(result.status)}
+}
+
+func checkLoaded(ctx context.Context, clock clockLib.Clock, warnDays int, envPath string, dir string) checkResult {
+	airacManager := airac.NewAirac(clock)
+	currentCycle := airacManager.CurrentCycle()
+	nextCycle := airacManager.NextCycleFrom(currentCycle)
+	_, nextStaged := download.StagedFile(dir, nextCycle.Ident)
+
+	result := checkResult{
+		Current:       newAiracCycleJson(currentCycle),
+		Next:          newAiracCycleJson(nextCycle),
+		NextStaged:    nextStaged,
+		DaysUntilNext: int(nextCycle.Start.Sub(clock.Now()).Hours() / 24),
+	}
+
+	status := func(status checkStatus, format string, args ...any) checkResult {
+		result.status = status
+		result.Status = status.String()
+		result.Code = int(status)
+		result.Message = fmt.Sprintf(format, args...)
+		return result
+	}
+
+	// Prefer the database's record of what is loaded, if one is configured
+	if err := loadDotenvIfExists(envPath); err != nil {
+		return status(checkUnknown, "failed to load environment file: %v", err)
+	}
+
+	loadedCycle, err := airac.NewLoadedAirac(dir)
+	if err != nil {
+		return status(checkUnknown, "failed to read loaded cycle: %v", err)
+	}
+	defer loadedCycle.Close()
+
+	loadDatabaseState(ctx, loadedCycle)
+
+	if loadedCycle.Ident() == "" {
+		return status(checkCritical, "no AIRAC cycle is loaded, current cycle is %v", currentCycle.Ident)
+	}
+
+	loaded, err := airacManager.CycleFromIdent(loadedCycle.Ident())
+	if err != nil {
+		return status(checkUnknown, "loaded AIRAC cycle %q is not valid", loadedCycle.Ident())
+	}
+
+	loadedJson := newAiracCycleJson(loaded)
+	result.Loaded = &loadedJson
+
+	switch {
+	case loaded.Before(currentCycle):
+		return status(
+			checkCritical,
+			"loaded AIRAC cycle %v is out of date, current cycle %v started %v",
+			loaded.Ident,
+			currentCycle.Ident,
+			currentCycle.Start.Format("2006-01-02"),
+		)
+	case loaded.After(currentCycle):
+		return status(checkWarning, "loaded AIRAC cycle %v is ahead of the current cycle %v", loaded.Ident, currentCycle.Ident)
+	case !nextStaged && nextCycle.Start.Sub(clock.Now()) <= time.Duration(warnDays)*24*time.Hour:
+		return status(
+			checkWarning,
+			"loaded AIRAC cycle %v is current, but cycle %v starts %v and has not been staged",
+			loaded.Ident,
+			nextCycle.Ident,
+			nextCycle.Start.Format("2006-01-02"),
+		)
+	default:
+		return status(checkOk, "loaded AIRAC cycle %v is current", loaded.Ident)
+	}
+}
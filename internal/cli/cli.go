@@ -2,42 +2,106 @@ package cli
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kong"
+	clockLib "github.com/benbjohnson/clock"
 	"github.com/joho/godotenv"
+	"github.com/mattn/go-isatty"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/config"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/db"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/download"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/excel"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/file"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/lock"
+	loggerLib "github.com/VATSIM-UK/ukcp-srd-tools/internal/logger"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/metrics"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/note"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/notify"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/parse"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/progress"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/srd"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/tracing"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/version"
 )
 
+// ExitCodeCancelled is the exit code used when a command is cancelled by a signal, as a shell would for SIGINT
+const ExitCodeCancelled = 130
+
+// dataDirName is the name of the data directory inside the XDG state directory
+const dataDirName = "ukcp-srd-tools"
+
 // CLI is the command line interface structure
 var CLI struct {
 	Loaded struct {
+		// EnvPath is an optional argument, presented as --env-path or -e, if the file configures a database then its record of the loaded cycle is shown too
+		EnvPath string `short:"e" help:"Path to the .env file, used to also show the loaded cycle recorded in the database" default:".env"`
 	} `cmd:"" help:"Show information about the currently loaded airac version"`
+	Check struct {
+		// WarnDays is presented as --warn-days or -w, how close the next cycle has to be before it must be staged
+		WarnDays int `short:"w" help:"Warn when the next AIRAC cycle starts within this many days and hasn't been staged" default:"7"`
+
+		// Format is presented as --format or -o, it controls whether output is a status line or JSON
+		Format string `short:"o" help:"The output format, text or json" enum:"text,json" default:"text"`
+
+		// EnvPath is an optional argument, presented as --env-path or -e, if the file configures a database then its record of the loaded cycle is checked
+		EnvPath string `short:"e" help:"Path to the .env file, used to check the loaded cycle recorded in the database" default:".env"`
+	} `cmd:"" help:"Check the loaded AIRAC cycle is up to date, exiting with Nagios plugin status codes"`
 	Parse struct {
 		Filename string `arg:"" name:"filename" type:"path" help:"The filename of the SRD file to parse"`
+
+		// Strict is presented as --strict, it fails the parse if any route refers to a missing note
+		Strict bool `help:"Fail if any route refers to a note that is missing from the file"`
 	} `cmd:"" help:"Parse an SRD file"`
 	Airac struct {
-	} `cmd:"" help:"Get information about the current AIRAC cycle"`
+		// Format is presented as --format or -o, it controls whether output is a table or JSON
+		Format string `short:"o" help:"The output format, table or json" enum:"table,json" default:"table"`
+
+		Show struct {
+			// Date is an optional argument, presented as --date, to look up the cycle on a given day instead of today
+			Date string `help:"Show the AIRAC cycle in effect on this date (YYYY-MM-DD) instead of the current cycle"`
+		} `cmd:"" default:"withargs" help:"Show the current and next AIRAC cycles"`
+
+		List struct {
+			// Year is an optional argument, presented as --year or -y, defaulting to the current year
+			Year int `short:"y" help:"The year to list the AIRAC cycles of, defaults to the current year"`
+		} `cmd:"" help:"List the AIRAC cycles in a year"`
+
+		Ics struct {
+			// Year is an optional, repeatable argument, presented as --year or -y, defaulting to this year and next
+			Year []int `short:"y" help:"The years to include in the calendar, defaults to the current and next year"`
+		} `cmd:"" help:"Export the AIRAC cycle start dates as an iCalendar (RFC 5545) file on stdout"`
+	} `cmd:"" help:"Get information about AIRAC cycles"`
 	Import struct {
-		Cycle string `arg:"" name:"cycle" help:"The identfier of the AIRAC cycle being imported"`
+		Cycle string `arg:"" name:"cycle" help:"The identfier of the AIRAC cycle being imported, as YYNN or YYYYNN"`
 
 		Filename string `arg:"" name:"filename" type:"path" help:"The filename of the SRD file to import"`
 
 		// EnvPath is an optional argument, presented as --env-path or -e, its default value is .env
 		EnvPath string `short:"e" help:"Path to the .env file" default:".env"`
+
+		// AcceptRisk is presented as --accept-risk, it commits an import that breaks the safety thresholds
+		AcceptRisk bool `help:"Import even if the file looks suspicious, such as having many invalid rows or far fewer routes than are loaded"`
+
+		// Strict is presented as --strict, it fails the import if any route refers to a missing note
+		Strict bool `help:"Fail the import if any route refers to a note that is missing from the file"`
 	} `cmd:"" help:"Import an SRD file"`
 	Download struct {
 		// Force is an argument presented as --force or -f
@@ -47,17 +111,88 @@ var CLI struct {
 		EnvPath string `short:"e" help:"Path to the .env file" default:".env"`
 
 		// Cycle is an optional argument, presented as --cycle or -c, used with the Force argument to force set the AIRAC cycle
-		Cycle string `short:"c" help:"The identfier of the AIRAC cycle to download"`
+		Cycle string `short:"c" help:"The identfier of the AIRAC cycle to download, as YYNN or YYYYNN" xor:"target"`
+
+		// Next is presented as --next or -n, it downloads the next AIRAC cycle's SRD and stages it rather than importing it
+		Next bool `short:"n" help:"Download the next AIRAC cycle's SRD ahead of its effective date and stage it, without importing" xor:"target"`
+
+		// Check is presented as --check, it only reports whether the SRD is available to download
+		Check bool `help:"Only check whether the SRD file is available to download, without downloading it"`
+
+		// AcceptRisk is presented as --accept-risk, it commits an import that breaks the safety thresholds
+		AcceptRisk bool `help:"Import even if the file looks suspicious, such as having many invalid rows or far fewer routes than are loaded"`
+
+		// Strict is presented as --strict, it fails the import if any route refers to a missing note
+		Strict bool `help:"Fail the import if any route refers to a note that is missing from the file"`
 
 		// A forced URL to download the SRD file from
 		Url string `short:"u" help:"The URL to download the SRD file from"`
+
+		// How to work out the download URL when one isn't forced
+		Discover    bool   `help:"Search the NATS digital datasets page for the SRD link, falling back to the URL template"`
+		IndexUrl    string `help:"The page to search for the SRD link when using --discover"`
+		UrlTemplate string `help:"Go template for the SRD download URL, with .Ident, .Cycle, .Year and .ShortYear available"`
+
+		// Limits applied when extracting the SRD workbook from the downloaded archive
+		MaxArchiveMb        int64   `help:"Maximum size of the downloaded archive in MiB, 0 for no limit" default:"100"`
+		MaxWorkbookMb       int64   `help:"Maximum uncompressed size of the SRD workbook in MiB, 0 for no limit" default:"250"`
+		MaxCompressionRatio float64 `help:"Maximum compression ratio of the SRD workbook in the archive, 0 for no limit" default:"100"`
+		WorkbookPattern     string  `help:"Regular expression matched against file names in the archive to find the SRD workbook (default: .xls or .xlsx)"`
 	} `cmd:"" help:"Download the SRD file"`
+	Lock struct {
+		Status struct {
+			// Format is presented as --format or -o, it controls whether output is log lines or JSON
+			Format string `short:"o" help:"The output format, text or json" enum:"text,json" default:"text"`
+		} `cmd:"" help:"Show whether the process lock is held, and by which process, without taking it"`
+	} `cmd:"" help:"Inspect the process lock for the data directory"`
+	Config struct {
+		Show struct {
+			// EnvPath is an optional argument, presented as --env-path or -e, the settings in it are shown too
+			EnvPath string `short:"e" help:"Path to the .env file, whose settings override the config file" default:".env"`
+		} `cmd:"" help:"Show the effective configuration, with secrets redacted"`
+	} `cmd:"" help:"Inspect the configuration"`
 	// Add a verbosity flag to the CLI, represented as -v or --verbose. This increases the log level to debug
 	Verbose bool `short:"v" help:"Enable debug logging"`
 
 	// Add a debug flag to the CLI, represented as -d or --debug. This increases the log level to trace
 	Debug bool `short:"d" help:"Enable trace logging"`
 
+	// LogFormat is presented as --log-format, console for people or json for log collectors
+	LogFormat string `help:"The log format, console or json" enum:"console,json" default:"console" env:"SRD_LOG_FORMAT"`
+
+	// LogFile is presented as --log-file, logs are written to it instead of stderr and it is rotated as it grows
+	LogFile       string `help:"Write logs to this file instead of stderr, rotating it as it grows" env:"SRD_LOG_FILE"`
+	LogMaxSize    int    `name:"log-max-size" help:"Size in MiB the log file reaches before it is rotated" default:"100"`
+	LogMaxBackups int    `help:"How many rotated log files to keep, 0 to keep them all" default:"5"`
+	LogMaxAge     int    `help:"How many days to keep rotated log files, 0 to keep them forever" default:"28"`
+
+	// MetricsTextfileDir is presented as --metrics-textfile-dir, import and download metrics are written there for the node_exporter textfile collector
+	MetricsTextfileDir string `help:"Write Prometheus metrics of imports and downloads to this node_exporter textfile collector directory" env:"SRD_METRICS_TEXTFILE_DIR"`
+
+	// MetricsPushUrl is presented as --metrics-push-url, import and download metrics are pushed to the Pushgateway there
+	MetricsPushUrl string `help:"Push Prometheus metrics of imports and downloads to the Pushgateway at this URL" env:"SRD_METRICS_PUSH_URL"`
+
+	// TraceEndpoint is presented as --trace-endpoint, spans of downloads, parses and imports are sent there
+	TraceEndpoint string `help:"Send OpenTelemetry traces of downloads, parses and imports to this OTLP/HTTP endpoint, such as http://localhost:4318" env:"SRD_TRACE_ENDPOINT"`
+
+	// ConfigFile is presented as --config, a YAML file of settings that may have named profiles
+	ConfigFile string `name:"config" help:"Path to a YAML config file (default: $XDG_CONFIG_HOME/ukcp-srd-tools/config.yaml, if it exists)" env:"SRD_CONFIG"`
+
+	// Profile is presented as --profile or -p, the profile in the config file to use
+	Profile string `short:"p" help:"The profile in the config file to use, instead of the file's default profile" env:"SRD_PROFILE"`
+
+	// DataDir is presented as --data-dir, it is where the loaded cycle, lock and downloaded files are kept
+	DataDir string `help:"Directory for the loaded cycle state, process lock and downloaded files (default: $XDG_STATE_HOME/ukcp-srd-tools)" env:"SRD_DATA_DIR"`
+
+	// Wait is presented as --wait, it is how long to wait for another process using the same data directory
+	Wait time.Duration `help:"How long to wait for another process using the same data directory to finish before giving up" default:"0s"`
+
+	// DbLockTimeout is presented as --db-lock-timeout, it is how long an import waits for another host's import into the same database
+	DbLockTimeout time.Duration `help:"How long to wait for another import into the same database to finish before giving up" default:"0s"`
+
+	// Now is presented as --now, it fixes the current time so that cycle changeovers can be rehearsed
+	Now string `help:"Pretend the current time is this (RFC 3339 or YYYY-MM-DD), to simulate a different date" env:"SRD_NOW"`
+
 	// The Testing flag is used to enable testing mode, it prevents logger modifications.
 	// The flag takes no arguments and is represented as -t or --testing
 	Testing bool `short:"t" help:"Enable testing mode"`
@@ -67,12 +202,18 @@ var (
 	// Invalid command errors
 	ErrInvalidCommandFormat = errors.New("invalid command format - check the code")
 	ErrAlreadyRunning       = errors.New("another process is already running")
+	ErrCancelled            = errors.New("cancelled")
 	ErrFailedProcessLock    = errors.New("failed to acquire process lock")
 	ErrUnknownFileExtension = errors.New("unknown file extension, must be .xls or .xlsx")
 	ErrCannotLoadDotenv     = errors.New("failed to load environment file")
+	ErrInvalidPattern       = errors.New("invalid workbook pattern")
+	ErrInvalidDate          = errors.New("invalid date, must be in the format YYYY-MM-DD")
+	ErrInvalidDataDir       = errors.New("failed to create data directory")
+	ErrInvalidNow           = errors.New("invalid --now time, must be RFC 3339 (e.g. 2026-01-22T00:00:00Z) or YYYY-MM-DD")
 
 	// Misc runtime errors
-	ErrUpToDate = errors.New("SRD file is up to date, use --force to download anyway")
+	ErrUpToDate      = errors.New("SRD file is up to date, use --force to download anyway")
+	ErrAlreadyStaged = errors.New("SRD file is already staged, use --force to download anyway")
 
 	// Database-specific errors
 	ErrMissingHost     = errors.New("missing database host")
@@ -83,35 +224,94 @@ var (
 	ErrPortInvalid     = errors.New("invalid database port")
 )
 
-// Run runs the CLI, parsing the command line arguments and executing the appropriate command
+// Run runs the CLI, parsing the command line arguments and executing the appropriate command.
+// The directory is where files are kept, unless another is given with --data-dir.
+// SIGINT and SIGTERM cancel the command, which stops at the next opportunity and cleans up after itself.
 func Run(dir string) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Once cancelled, restore the default handling so that a second signal stops the process straight away
+	context.AfterFunc(ctx, stop)
 
+	return RunContext(ctx, dir)
+}
+
+// RunContext is Run, with the command cancelled when the context is. If the command didn't finish
+// because of this, the error returned wraps ErrCancelled.
+func RunContext(ctx context.Context, dir string) error {
+	err := runCommand(ctx, dir)
+	if err != nil && ctx.Err() != nil {
+		log.Warn().Msg("cancelled before finishing, any partial import has been rolled back")
+		return fmt.Errorf("%w: %v", ErrCancelled, err)
+	}
+
+	return err
+}
+
+func runCommand(ctx context.Context, dir string) error {
 	cmd := kong.Parse(&CLI)
-	configureLogging()
+	closeLog, err := configureLogging()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	shutdownTracing, err := configureTracing(ctx)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing()
+
+	// Each run reports only its own metrics
+	runMetrics = metrics.NewRecorder(metrics.NewRegistry())
+
+	err = configureConfig(CLI.ConfigFile, CLI.Profile)
+	if err != nil {
+		return err
+	}
+
+	dir, err = configureDataDir(CLI.DataDir, dir)
+	if err != nil {
+		return err
+	}
+
+	clock, err := configureClock(CLI.Now)
+	if err != nil {
+		return err
+	}
 
 	switch cmd.Command() {
 	case "parse <filename>":
-		return doParse()
+		return doParse(ctx)
 	case "import <cycle> <filename>":
-		return doImport(ctx, CLI.Import.Filename, CLI.Import.Cycle, CLI.Import.EnvPath, dir)
-	case "airac":
-		return doAirac()
+		return doImport(ctx, clock, CLI.Import.Filename, CLI.Import.Cycle, CLI.Import.EnvPath, importChecks{acceptRisk: CLI.Import.AcceptRisk, strict: CLI.Import.Strict}, dir)
+	case "airac show":
+		return doAirac(clock, CLI.Airac.Show.Date, CLI.Airac.Format)
+	case "airac list":
+		return doAiracList(clock, CLI.Airac.List.Year, CLI.Airac.Format)
+	case "airac ics":
+		return doAiracIcs(clock, CLI.Airac.Ics.Year)
 	case "download":
-		return doDownload(ctx, CLI.Download.Force, CLI.Download.Cycle, CLI.Download.EnvPath, dir)
+		return doDownload(ctx, clock, CLI.Download.Force, CLI.Download.Cycle, CLI.Download.EnvPath, dir)
+	case "check":
+		return doCheck(ctx, clock, CLI.Check.WarnDays, CLI.Check.Format, CLI.Check.EnvPath, dir)
 	case "loaded":
-		return doLoaded(dir)
+		return doLoaded(ctx, clock, CLI.Loaded.EnvPath, dir)
+	case "config show":
+		return doConfigShow(CLI.Config.Show.EnvPath, dir)
+	case "lock status":
+		return doLockStatus(dir, CLI.Lock.Status.Format)
 	default:
 		return ErrInvalidCommandFormat
 	}
 }
 
-// configureLogging configures the logging based on the CLI flags
+// configureLogging configures the logging based on the CLI flags, returning a function that closes the log file
 // if the testing flag is set, logging is controlled by the test
-func configureLogging() {
+func configureLogging() (func(), error) {
 	if CLI.Testing {
-		return
+		return func() {}, nil
 	}
 
 	// Set the log level to trace if the debug flag is set
@@ -123,106 +323,312 @@ func configureLogging() {
 		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
 
-	// Turn on pretty console logging, if the unit tests are running, disable this
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	// Log for people or machines, to stderr or a file
+	logger, closer, err := loggerLib.New(loggerLib.Options{
+		Format:     CLI.LogFormat,
+		File:       CLI.LogFile,
+		MaxSizeMb:  CLI.LogMaxSize,
+		MaxBackups: CLI.LogMaxBackups,
+		MaxAgeDays: CLI.LogMaxAge,
+	}, os.Stderr)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to configure logging")
+		return nil, err
+	}
+
+	log.Logger = logger
+	return func() {
+		if err := closer.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to close log file: %v\n", err)
+		}
+	}, nil
+}
+
+// DefaultDataDir returns the directory used when --data-dir isn't given, following the XDG base directory
+// specification for state that should survive a reboot
+func DefaultDataDir() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return filepath.Join(os.TempDir(), dataDirName)
+		}
+
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(stateHome, dataDirName)
+}
+
+// configureDataDir picks the data directory, preferring the one given on the command line, then the one in the
+// config file, and makes sure it exists
+func configureDataDir(flagDir string, defaultDir string) (string, error) {
+	dir := defaultDir
+	if flagDir != "" {
+		dir = flagDir
+	} else if fileConfig.DataDir != "" {
+		dir = fileConfig.DataDir
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to create data directory %v", dir)
+		return "", ErrInvalidDataDir
+	}
+
+	log.Debug().Msgf("Using data directory %v", dir)
+	return dir, nil
+}
+
+// configureClock returns the clock used by all commands, if a time is given then
+// the clock is fixed at that time, otherwise it is the real clock
+func configureClock(now string) (clockLib.Clock, error) {
+	if now == "" {
+		return clockLib.New(), nil
+	}
+
+	fixedTime, err := time.Parse(time.RFC3339, now)
+	if err != nil {
+		fixedTime, err = time.Parse("2006-01-02", now)
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msgf("invalid time %v", now)
+		return nil, ErrInvalidNow
+	}
+
+	log.Warn().Msgf("Simulating the current time as %v", fixedTime.UTC().Format(time.RFC3339))
+
+	clock := clockLib.NewMock()
+	clock.Set(fixedTime)
+
+	return clock, nil
 }
 
 // doParse parses an SRD file to check for errors
-func doParse() error {
+func doParse(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "parse")
+	defer func() { tracing.End(span, err) }()
+
 	// Get the filename from the command line
 	path, err := filepath.Abs(CLI.Parse.Filename)
 	if err != nil {
 		return err
 	}
 
-	file, err := loadSrdFile(path)
+	file, err := loadSrdFile(ctx, path)
 	if err != nil {
 		return err
 	}
 
 	// Parse the SRD file
-	log.Info().Msgf("Parsing SRD file %v", path)
-	summary := parse.ParseSrd(file)
+	log.Info().Str("file", path).Msgf("Parsing SRD file %v", path)
+	summary, dangling := parse.ParseSrd(file)
 
 	printStats(summary)
+	printDanglingReferences(dangling)
+	if CLI.Parse.Strict && len(dangling) > 0 {
+		return &note.DanglingReferencesError{References: dangling}
+	}
+
 	return nil
 }
 
-func doLoaded(dir string) error {
+// doLoaded reports the loaded AIRAC cycle recorded in the local file and, if one is configured, the database
+func doLoaded(ctx context.Context, clock clockLib.Clock, envPath string, dir string) error {
 	loadedCycle, err := airac.NewLoadedAirac(dir)
 	if err != nil {
 		return err
 	}
 
+	airacManager := airac.NewAirac(clock)
 	if loadedCycle.Ident() == "" {
 		log.Info().Msgf("No AIRAC cycle loaded")
-		return nil
+	} else {
+		logLoadedState(airacManager, "Loaded AIRAC cycle", loadedCycle.State())
 	}
 
-	// Get the current AIRAC cycle
-	airacManager := airac.NewAirac(nil)
-	currentCycle, _ := airacManager.CycleFromIdent(loadedCycle.Ident())
+	// The database is shared between every host that imports into it, so report what it has too
+	if err := loadDotenvIfExists(envPath); err != nil {
+		return err
+	}
 
-	log.Info().Msgf(
-		"Loaded AIRAC cycle is %v (%v - %v)",
-		currentCycle.Ident,
-		currentCycle.Start.Format("2006-01-02"),
-		currentCycle.End.Format("2006-01-02"),
-	)
+	configured, err := databaseConfigured()
+	if err != nil || !configured {
+		return err
+	}
+
+	dbParams, err := getDatabaseConnectionParams()
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to get database connection parameters: %v", err)
+		return err
+	}
+
+	database, err := db.NewDatabase(dbParams)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := database.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to close database connection")
+		}
+	}()
+
+	dbState, found, err := database.LoadedState(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		log.Info().Msgf("No AIRAC cycle recorded in the database")
+		return nil
+	}
+
+	logLoadedState(airacManager, "Loaded AIRAC cycle in the database", dbState)
+	if dbState.Ident != loadedCycle.Ident() {
+		log.Warn().Msgf(
+			"The local file records AIRAC cycle %q but the database records %q, the database is what has been imported",
+			loadedCycle.Ident(),
+			dbState.Ident,
+		)
+	}
 
 	return nil
 }
 
+// logLoadedState logs everything recorded about a loaded cycle
+func logLoadedState(airacManager *airac.Airac, description string, state airac.LoadedState) {
+	cycle, err := airacManager.CycleFromIdent(state.Ident)
+	if err != nil {
+		log.Warn().Err(err).Msgf("%v is %v, which is not a valid cycle", description, state.Ident)
+	} else {
+		logAiracCycle(description, cycle)
+	}
+
+	// Older versions only recorded the ident, so only print what we know
+	if !state.ImportedAt.IsZero() {
+		log.Info().Msgf("Imported at %v", state.ImportedAt.UTC().Format(time.RFC3339))
+	}
+
+	if state.SourceFile != "" {
+		log.Info().Msgf("Imported from file %v (sha256 %v)", state.SourceFile, state.SourceChecksum)
+	}
+
+	if state.SourceUrl != "" {
+		log.Info().Msgf("Downloaded from %v", state.SourceUrl)
+	}
+
+	if !state.ImportedAt.IsZero() {
+		printStats(file.SrdStats{
+			RouteCount:      state.RouteCount,
+			RouteErrorCount: state.RouteErrorCount,
+			NoteCount:       state.NoteCount,
+			NoteErrorCount:  state.NoteErrorCount,
+		})
+	}
+
+	if state.ToolVersion != "" {
+		log.Info().Msgf("Imported by ukcp-srd-tools %v", state.ToolVersion)
+	}
+}
+
+// loadDatabaseState replaces the loaded cycle from the local file with the one recorded in the database, if one
+// is configured, as that is what has actually been imported. If the database can't be read, the file is used.
+func loadDatabaseState(ctx context.Context, loadedCycle *airac.LoadedAirac) {
+	configured, err := databaseConfigured()
+	if err != nil || !configured {
+		return
+	}
+
+	dbParams, err := getDatabaseConnectionParams()
+	if err != nil {
+		log.Warn().Err(err).Msg("invalid database settings, using the local file for the loaded cycle")
+		return
+	}
+
+	database, err := db.NewDatabase(dbParams)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to connect to database to read the loaded cycle, using the local file")
+		return
+	}
+
+	defer func() {
+		if err := database.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to close database connection")
+		}
+	}()
+
+	found, err := loadedCycle.LoadFrom(ctx, "database", database)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to read the loaded cycle from the database, using the local file")
+		return
+	}
+
+	if found {
+		log.Debug().Msgf("Loaded cycle %v read from the database", loadedCycle.Ident())
+	}
+}
+
 func printStats(stats file.SrdStats) {
-	log.Info().Msgf("processed %v routes with %v errors", stats.RouteCount, stats.RouteErrorCount)
-	log.Info().Msgf("processed %v notes with %v errors", stats.NoteCount, stats.NoteErrorCount)
-}
-
-// doAirac gets information about the current AIRAC cycle
-func doAirac() error {
-	// Get the current AIRAC cycle
-	airac := airac.NewAirac(nil)
-
-	currentCycle := airac.CurrentCycle()
-
-	// Print the current cycle identifier with the start and end dates, dates to be formatted as "YYYY-MM-DD"
-	log.Info().Msgf(
-		"Current AIRAC cycle is %v (%v - %v)",
-		currentCycle.Ident,
-		currentCycle.Start.Format("2006-01-02"),
-		currentCycle.End.Format("2006-01-02"),
-	)
-
-	// Print the next cycle identifier with the start and end dates
-	nextCycle := airac.NextCycleFrom(currentCycle)
-	log.Info().Msgf(
-		"Next AIRAC cycle is %v (%v - %v)",
-		nextCycle.Ident,
-		nextCycle.Start.Format("2006-01-02"),
-		nextCycle.End.Format("2006-01-02"),
-	)
+	log.Info().Int("routes", stats.RouteCount).Int("route_errors", stats.RouteErrorCount).
+		Msgf("processed %v routes with %v errors", stats.RouteCount, stats.RouteErrorCount)
+	log.Info().Int("notes", stats.NoteCount).Int("note_errors", stats.NoteErrorCount).
+		Msgf("processed %v notes with %v errors", stats.NoteCount, stats.NoteErrorCount)
+}
 
-	return nil
+// printDanglingReferences prints how many routes refer to notes that are missing from the file
+func printDanglingReferences(references []note.DanglingReference) {
+	if len(references) > 0 {
+		log.Warn().Int("dangling_references", len(references)).Msgf("found %v references to missing notes, those routes don't have the notes' restrictions", len(references))
+	}
+}
+
+// importChecks are how strictly an import is checked before it is committed
+type importChecks struct {
+	// Commit the import even if it breaks the safety thresholds
+	acceptRisk bool
+
+	// Fail the import if any route refers to a missing note
+	strict bool
 }
 
 // doImport imports an SRD file into the database
 // it requires that the process lock is acquired before calling this function
-func doImport(ctx context.Context, filePath string, cycle string, envPath string, fileDir string) error {
-	unlock, err := processLock()
+func doImport(ctx context.Context, clock clockLib.Clock, filePath string, cycle string, envPath string, checks importChecks, fileDir string) (err error) {
+	defer func(started time.Time) { exportMetrics(ctx, "import", started, err, fileDir) }(time.Now())
+
+	unlock, err := processLock(ctx, fileDir, "import", CLI.Wait)
 	if err != nil {
 		return err
 	}
 	defer unlock()
 
-	return importProcess(ctx, filePath, cycle, envPath, fileDir)
+	return importProcess(ctx, clock, filePath, "", cycle, envPath, checks, fileDir)
 }
 
-// importProcess performs the import process and is shared between the import command and the download command
-func importProcess(ctx context.Context, filePath string, cycle string, envPath string, fileDir string) error {
+// importProcess performs the import process and is shared between the import command and the download command,
+// the source URL is recorded with the loaded cycle and is empty when importing a local file.
+// The checks decide whether a suspicious import is committed.
+func importProcess(ctx context.Context, clock clockLib.Clock, filePath string, sourceUrl string, cycle string, envPath string, checks importChecks, fileDir string) (err error) {
+	ctx, span := tracing.Start(ctx, "import", attribute.String("cycle", cycle))
+	defer func() { tracing.End(span, err) }()
+
+	// Let people know how the import went, the state is filled in as it goes
+	var previousState, loadedState airac.LoadedState
+	defer func() {
+		sendNotification(ctx, importNotification(cycle, previousState, loadedState, err, clock.Now().UTC()))
+	}()
+
 	// Get the filename from the command line
 	path, _ := filepath.Abs(filePath)
 
-	file, err := loadSrdFile(path)
+	file, err := loadSrdFile(ctx, path)
 	if err != nil {
 		return err
 	}
@@ -234,19 +640,28 @@ func importProcess(ctx context.Context, filePath string, cycle string, envPath s
 	}()
 
 	// Check the cycle is valid
-	airacCycles := airac.NewAirac(nil)
+	airacCycles := airac.NewAirac(clock)
 	airacCycle, err := airacCycles.CycleFromIdent(cycle)
 	if err != nil {
 		return err
 	}
 
-	log.Info().Msgf("importing SRD file %v for cycle %v", path, airacCycle.Ident)
+	log.Info().Str("cycle", airacCycle.Ident).Str("file", path).Msgf("importing SRD file %v for cycle %v", path, airacCycle.Ident)
+
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
 
 	// Load the .env file
-	err = godotenv.Overload(envPath)
+	err = loadDotenv(envPath)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to load environment file")
-		return ErrCannotLoadDotenv
+		return err
+	}
+
+	cfg, err := settings()
+	if err != nil {
+		return err
 	}
 
 	// Get the database connection parameters
@@ -256,6 +671,13 @@ func importProcess(ctx context.Context, filePath string, cycle string, envPath s
 		return err
 	}
 
+	// Stop other hosts importing into the same database at the same time, the process lock only covers this host
+	unlockDatabase, err := databaseLock(ctx, dbParams, CLI.DbLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlockDatabase()
+
 	// Create a database connection
 	db, err := db.NewDatabase(dbParams)
 	if err != nil {
@@ -268,58 +690,225 @@ func importProcess(ctx context.Context, filePath string, cycle string, envPath s
 		}
 	}()
 
+	// Make sure there's somewhere to record the import alongside the data
+	err = db.EnsureMetaTable(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The cycle being replaced is the one recorded in the database, as other hosts may have imported into it since
+	// the local file was written. The file is only used if the database has no record or can't be read.
+	loadedCycle, err := airac.NewLoadedAirac(fileDir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := loadedCycle.LoadFrom(ctx, "database", db); err != nil {
+		log.Warn().Err(err).Msg("failed to read the loaded cycle from the database, using the local file")
+	}
+
+	previousState = loadedCycle.State()
+
+	// The record of the import is written in the same transaction as the data, once the file has been read
+	recordLoadedState := func() airac.LoadedState {
+		stats := file.Stats()
+		loadedState = airac.LoadedState{
+			Ident:           airacCycle.Ident,
+			ImportedAt:      clock.Now().UTC(),
+			SourceFile:      path,
+			SourceChecksum:  checksum,
+			SourceUrl:       sourceUrl,
+			RouteCount:      stats.RouteCount,
+			RouteErrorCount: stats.RouteErrorCount,
+			NoteCount:       stats.NoteCount,
+			NoteErrorCount:  stats.NoteErrorCount,
+			ToolVersion:     version.String(),
+		}
+
+		return loadedState
+	}
+
+	importOptions := []srd.Option{srd.WithProgress(progressReporter()), srd.WithLoadedState(recordLoadedState)}
+	if cfg.Import.BatchSize > 0 {
+		importOptions = append(importOptions, srd.WithBatchSize(cfg.Import.BatchSize))
+	}
+
+	if cfg.Import.BatchWait != nil {
+		importOptions = append(importOptions, srd.WithBatchWait(*cfg.Import.BatchWait))
+	}
+
+	importOptions = append(importOptions, srd.WithRetry(importRetryPolicy(cfg.Import)))
+	importOptions = append(importOptions, srd.WithThresholds(importThresholds(cfg.Import.Thresholds), checks.acceptRisk))
+	importOptions = append(importOptions, srd.WithStrict(checks.strict))
+
 	// Create the importer and go
-	importer := srd.NewImport(file, db)
+	importer := srd.NewImport(file, db, importOptions...)
 
+	start := time.Now()
 	err = importer.Import(ctx)
-	if err != nil {
+	runMetrics.ParseErrors(file.Stats().RouteErrorCount, file.Stats().NoteErrorCount)
+	if errors.Is(err, note.ErrDanglingReferences) {
+		log.Error().Err(err).Str("cycle", airacCycle.Ident).Int("dangling_references", len(importer.DanglingReferences())).Msgf("the import was rolled back as %v routes refer to missing notes, run without --strict to import them without the notes", len(importer.DanglingReferences()))
 		return err
 	}
 
-	log.Info().Msgf("imported SRD for cycle %v", CLI.Import.Cycle)
+	if errors.Is(err, srd.ErrSuspiciousImport) {
+		log.Error().Err(err).Str("cycle", airacCycle.Ident).Msg("the import was rolled back and the loaded SRD is unchanged, check the file or use --accept-risk to import it anyway")
+		return err
+	}
 
-	// Set the SRD cycle
-	loadedCycle, err := airac.NewLoadedAirac(fileDir)
 	if err != nil {
 		return err
 	}
 
-	err = loadedCycle.Set(airacCycle)
+	log.Info().
+		Str("cycle", airacCycle.Ident).
+		Str("file", path).
+		Int("routes", loadedState.RouteCount).
+		Int("route_errors", loadedState.RouteErrorCount).
+		Int("notes", loadedState.NoteCount).
+		Int("note_errors", loadedState.NoteErrorCount).
+		Dur("duration", time.Since(start)).
+		Msgf("imported SRD for cycle %v", airacCycle.Ident)
+
+	// Set the SRD cycle
+	err = loadedCycle.SetState(loadedState)
 	if err != nil {
 		return err
 	}
 
 	// Print the stats
 	printStats(file.Stats())
+	printDanglingReferences(importer.DanglingReferences())
 
 	return nil
 }
 
-// doDownload downloads the SRD file and imports it into the database
-func doDownload(ctx context.Context, force bool, forceCycle string, envPath string, fileDir string) error {
-	unlock, err := processLock()
+// importRetryPolicy returns how an import is retried after a transient database error, the defaults
+// overridden by any settings
+func importRetryPolicy(importConfig config.ImportConfig) db.RetryPolicy {
+	policy := db.DefaultRetryPolicy()
+	if importConfig.Attempts > 0 {
+		policy.Attempts = importConfig.Attempts
+	}
+
+	if importConfig.RetryBackoff != nil {
+		policy.Backoff = *importConfig.RetryBackoff
+	}
+
+	return policy
+}
+
+// importThresholds returns the limits an import must be within to be committed, the defaults overridden by any settings
+func importThresholds(thresholdsConfig config.ThresholdsConfig) srd.Thresholds {
+	thresholds := srd.DefaultThresholds()
+	if thresholdsConfig.MaxRouteErrorPercent != nil {
+		thresholds.MaxRouteErrorPercent = *thresholdsConfig.MaxRouteErrorPercent
+	}
+
+	if thresholdsConfig.MaxNoteErrorPercent != nil {
+		thresholds.MaxNoteErrorPercent = *thresholdsConfig.MaxNoteErrorPercent
+	}
+
+	if thresholdsConfig.MaxRouteDropPercent != nil {
+		thresholds.MaxRouteDropPercent = *thresholdsConfig.MaxRouteDropPercent
+	}
+
+	if thresholdsConfig.MaxNoteDropPercent != nil {
+		thresholds.MaxNoteDropPercent = *thresholdsConfig.MaxNoteDropPercent
+	}
+
+	thresholds.MinRoutes = int64(thresholdsConfig.MinRoutes)
+	thresholds.MinNotes = int64(thresholdsConfig.MinNotes)
+
+	return thresholds
+}
+
+// fileChecksum returns the hex encoded SHA-256 checksum of a file
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to open SRD file for checksum: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to checksum SRD file: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// doDownload downloads the SRD file and imports it into the database
+func doDownload(ctx context.Context, clock clockLib.Clock, force bool, forceCycle string, envPath string, fileDir string) (err error) {
+	defer func(started time.Time) { exportMetrics(ctx, "download", started, err, fileDir) }(time.Now())
+
+	ctx, span := tracing.Start(ctx, "download")
+	defer func() {
+		// Finding there is nothing to do isn't an error
+		if nothingToDo(err) {
+			tracing.End(span, nil)
+		} else {
+			tracing.End(span, err)
+		}
+	}()
+
+	// Let people know if the download failed, importProcess does so for the import
+	cycleIdent, importing := forceCycle, false
+	defer func() {
+		if err != nil && !importing && !CLI.Download.Check && !nothingToDo(err) {
+			sendNotification(ctx, notify.Notification{Event: notify.EventFailure, Stage: notify.StageDownload, Cycle: cycleIdent, Error: err.Error(), Time: clock.Now().UTC()})
+		}
+	}()
+
+	// Checking availability doesn't touch any files, so doesn't need the lock
+	if !CLI.Download.Check {
+		unlock, err := processLock(ctx, fileDir, "download", CLI.Wait)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	// Validate the environment before downloading, staging and checking don't need the database so the file is optional
+	if CLI.Download.Next || CLI.Download.Check {
+		if err := loadDotenvIfExists(envPath); err != nil {
+			return err
+		}
+	} else {
+		err := loadDotenv(envPath)
+		if err != nil {
+			return err
+		}
+
+		// Get and validate database connection parameters early
+		_, err = getDatabaseConnectionParams()
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to get database connection parameters: %v", err)
+			return err
+		}
 	}
-	defer unlock()
 
-	// Validate the environment before downloading
-	err = godotenv.Overload(envPath)
+	// Create the HTTP client used for everything download related
+	clientOptions, err := getDownloadClientOptions()
 	if err != nil {
-		log.Error().Err(err).Msg("failed to load environment file")
-		return ErrCannotLoadDotenv
+		log.Error().Err(err).Msgf("failed to get download client options: %v", err)
+		return err
 	}
 
-	// Get and validate database connection parameters early
-	_, err = getDatabaseConnectionParams()
+	client, err := download.NewHttpClient(clientOptions)
 	if err != nil {
-		log.Error().Err(err).Msgf("failed to get database connection parameters: %v", err)
+		log.Error().Err(err).Msgf("failed to create download client: %v", err)
 		return err
 	}
 
-	// Get the current AIRAC cycle
-	airacManager := airac.NewAirac(nil)
+	// Get the current AIRAC cycle, or the next one if we're staging ahead of time
+	airacManager := airac.NewAirac(clock)
 	cycleToDownload := airacManager.CurrentCycle()
+	if CLI.Download.Next {
+		cycleToDownload = airacManager.NextCycle()
+	}
 
 	// Set the import cycle, if not set use the current cycle
 	if forceCycle != "" {
@@ -329,37 +918,144 @@ func doDownload(ctx context.Context, force bool, forceCycle string, envPath stri
 		}
 	}
 
-	// Get the currently loaded cycle
+	cycleIdent = cycleToDownload.Ident
+	span.SetAttributes(attribute.String("cycle", cycleIdent))
+
+	// Get the currently loaded cycle, preferring the database's record when we have one
 	loadedCycle, err := airac.NewLoadedAirac(fileDir)
 	if err != nil {
 		return err
 	}
 
+	if !CLI.Download.Check {
+		loadDatabaseState(ctx, loadedCycle)
+	}
+
 	// Download the SRD file
-	downloadUrl := download.DownloadUrl(cycleToDownload)
-	if CLI.Download.Url != "" {
-		downloadUrl = CLI.Download.Url
+	downloadUrl := CLI.Download.Url
+	if downloadUrl == "" {
+		cfg, err := settings()
+		if err != nil {
+			return err
+		}
+
+		downloadUrl, err = download.ResolveUrl(ctx, client, cycleToDownload, download.UrlOptions{
+			Template: cfg.Download.UrlTemplate,
+			Discover: cfg.Download.Discover,
+			IndexUrl: cfg.Download.IndexUrl,
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	downloader, err := download.NewSrdDownloader(cycleToDownload, loadedCycle, fileDir, downloadUrl)
+	extractOptions, err := downloadExtractOptions()
 	if err != nil {
 		return err
 	}
 
+	downloaderOptions := []download.Option{
+		download.WithExtractOptions(extractOptions),
+		download.WithHttpClient(client),
+		download.WithProgress(progressReporter()),
+	}
+	if CLI.Download.Next {
+		downloaderOptions = append(downloaderOptions, download.WithStaging())
+	}
+
+	downloader, err := download.NewSrdDownloader(cycleToDownload, loadedCycle, fileDir, downloadUrl, downloaderOptions...)
+	if err != nil {
+		return err
+	}
+
+	if CLI.Download.Check {
+		return checkAvailable(ctx, downloader, cycleToDownload, downloadUrl, fileDir)
+	}
+
+	// When staging, make sure the SRD has been published before trying to download it
+	if CLI.Download.Next {
+		available, err := downloader.Available(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !available {
+			log.Info().Msgf("SRD for AIRAC cycle %v is not yet available at %v", cycleToDownload.Ident, downloadUrl)
+			return download.ErrNotYetAvailable
+		}
+	}
+
 	err = downloader.Download(ctx, force)
 	if err == download.ErrUpToDate {
 		return ErrUpToDate
+	} else if err == download.ErrAlreadyStaged {
+		return ErrAlreadyStaged
 	} else if err != nil {
 		return err
 	}
 
+	// Staged files are imported once their cycle becomes current
+	if CLI.Download.Next {
+		return nil
+	}
+
 	// Download happened, so now we do the import
-	return importProcess(ctx, downloader.LatestFileLocation(), cycleToDownload.Ident, envPath, fileDir)
+	importing = true
+	return importProcess(ctx, clock, downloader.LatestFileLocation(), downloadUrl, cycleToDownload.Ident, envPath, importChecks{acceptRisk: CLI.Download.AcceptRisk, strict: CLI.Download.Strict}, fileDir)
+}
+
+// nothingToDo reports whether a download failed only because there was nothing to do, which is a successful run
+func nothingToDo(err error) bool {
+	return errors.Is(err, ErrUpToDate) || errors.Is(err, ErrAlreadyStaged) || errors.Is(err, download.ErrNotYetAvailable)
+}
+
+// checkAvailable reports whether the SRD for a cycle has been published, and whether we've already staged it
+func checkAvailable(ctx context.Context, downloader *download.SrdDownloader, cycle *airac.AiracCycle, downloadUrl string, fileDir string) error {
+	available, err := downloader.Available(ctx)
+	if err != nil {
+		return err
+	}
+
+	if available {
+		log.Info().Msgf("SRD for AIRAC cycle %v is available at %v", cycle.Ident, downloadUrl)
+	} else {
+		log.Info().Msgf("SRD for AIRAC cycle %v is not yet available at %v", cycle.Ident, downloadUrl)
+	}
+
+	if stagedPath, ok := download.StagedFile(fileDir, cycle.Ident); ok {
+		log.Info().Msgf("SRD for AIRAC cycle %v is staged at %v", cycle.Ident, stagedPath)
+	}
+
+	return nil
+}
+
+// downloadExtractOptions builds the archive extraction limits from the download flags
+func downloadExtractOptions() (download.ExtractOptions, error) {
+	opts := download.ExtractOptions{
+		MaxArchiveSize:      CLI.Download.MaxArchiveMb * 1024 * 1024,
+		MaxWorkbookSize:     CLI.Download.MaxWorkbookMb * 1024 * 1024,
+		MaxCompressionRatio: CLI.Download.MaxCompressionRatio,
+		WorkbookPattern:     download.DefaultWorkbookPattern,
+	}
+
+	if CLI.Download.WorkbookPattern != "" {
+		pattern, err := regexp.Compile(CLI.Download.WorkbookPattern)
+		if err != nil {
+			log.Error().Err(err).Msgf("invalid workbook pattern %v", CLI.Download.WorkbookPattern)
+			return download.ExtractOptions{}, ErrInvalidPattern
+		}
+
+		opts.WorkbookPattern = pattern
+	}
+
+	return opts, nil
 }
 
 // loadSrdFile loads an SRD file from the given path
-func loadSrdFile(path string) (file.SrdFile, error) {
+func loadSrdFile(ctx context.Context, path string) (file.SrdFile, error) {
+	_, span := tracing.Start(ctx, "srd.open", attribute.String("file", path))
 	excelFile, err := loadExcelFile(path)
+	tracing.End(span, err)
 	if err != nil {
 		log.Error().Err(err).Msgf("failed to load excel file %v", path)
 		return nil, err
@@ -387,59 +1083,227 @@ func loadExcelFile(path string) (excel.ExcelFile, error) {
 	return nil, ErrUnknownFileExtension
 }
 
-// Get the database connection parameters from the .env file
+// databaseConfigured reports whether a database has been configured, commands that only report on it skip it if not
+func databaseConfigured() (bool, error) {
+	cfg, err := settings()
+	if err != nil {
+		return false, err
+	}
+
+	return cfg.Database.Configured(), nil
+}
+
+// Get the database connection parameters from the environment, or the config file
 func getDatabaseConnectionParams() (db.DatabaseConnectionParams, error) {
-	port := os.Getenv("DB_PORT")
-	if port == "" {
-		return db.DatabaseConnectionParams{}, ErrMissingPort
+	cfg, err := settings()
+	if err != nil {
+		return db.DatabaseConnectionParams{}, err
+	}
+
+	dbConfig := cfg.Database
+	params := db.DatabaseConnectionParams{
+		Tls: db.TlsParams{
+			Mode:       dbConfig.Tls.Mode,
+			CaFile:     dbConfig.Tls.CaFile,
+			CertFile:   dbConfig.Tls.CertFile,
+			KeyFile:    dbConfig.Tls.KeyFile,
+			ServerName: dbConfig.Tls.ServerName,
+		},
+		Charset:      dbConfig.Charset,
+		Timeout:      dbConfig.Timeout,
+		ReadTimeout:  dbConfig.ReadTimeout,
+		WriteTimeout: dbConfig.WriteTimeout,
 	}
 
-	// Convert port to an integer
-	portInt, err := strconv.Atoi(port)
+	// A DSN replaces all of the other connection settings
+	params.Dsn, err = readSecret(dbConfig.Dsn, dbConfig.DsnFile)
 	if err != nil {
-		return db.DatabaseConnectionParams{}, ErrPortInvalid
+		return db.DatabaseConnectionParams{}, err
 	}
 
-	// Check the other required parameters
-	host := os.Getenv("DB_HOST")
-	if host == "" {
-		return db.DatabaseConnectionParams{}, ErrMissingHost
+	if params.Dsn != "" {
+		params.Database, err = db.DsnDatabase(params.Dsn)
+		if err != nil {
+			return db.DatabaseConnectionParams{}, err
+		}
+
+		if params.Database == "" {
+			return db.DatabaseConnectionParams{}, ErrMissingDatabase
+		}
+
+		return params, nil
 	}
 
-	user := os.Getenv("DB_USERNAME")
-	if user == "" {
+	// A socket replaces the host and port
+	params.Socket = dbConfig.Socket
+	if params.Socket == "" {
+		port := dbConfig.Port
+		if port == "" {
+			return db.DatabaseConnectionParams{}, ErrMissingPort
+		}
+
+		// Convert port to an integer
+		params.Port, err = strconv.Atoi(port)
+		if err != nil {
+			return db.DatabaseConnectionParams{}, ErrPortInvalid
+		}
+
+		params.Host = dbConfig.Host
+		if params.Host == "" {
+			return db.DatabaseConnectionParams{}, ErrMissingHost
+		}
+	}
+
+	// Check the other required parameters
+	params.Username = dbConfig.Username
+	if params.Username == "" {
 		return db.DatabaseConnectionParams{}, ErrMissingUser
 	}
 
-	pass := os.Getenv("DB_PASSWORD")
-	if pass == "" {
+	params.Password, err = readSecret(dbConfig.Password, dbConfig.PasswordFile)
+	if err != nil {
+		return db.DatabaseConnectionParams{}, err
+	}
+
+	// Connections through a socket may be authenticated by the operating system user instead
+	if params.Password == "" && params.Socket == "" {
 		return db.DatabaseConnectionParams{}, ErrMissingPass
 	}
 
-	database := os.Getenv("DB_DATABASE")
-	if database == "" {
+	params.Database = dbConfig.Database
+	if params.Database == "" {
 		return db.DatabaseConnectionParams{}, ErrMissingDatabase
 	}
 
-	// Return the connection parameters
-	return db.DatabaseConnectionParams{
-		Host:     host,
-		Port:     portInt,
-		Username: user,
-		Password: pass,
-		Database: database,
+	return params, nil
+}
+
+// readSecret returns the value of a setting, or the contents of its file if the value isn't set
+func readSecret(value string, file string) (string, error) {
+	secret, err := config.ReadSecret(value, file)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to read secret from %v", file)
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// progressReporter shows progress as a bar when running in a terminal, and as periodic log lines otherwise
+func progressReporter() progress.Reporter {
+	// Progress bars are only drawn for people watching a terminal, otherwise progress is logged
+	reporter := progress.NewBarReporter(os.Stderr)
+	if CLI.Testing || CLI.LogFormat == loggerLib.FormatJson || CLI.LogFile != "" || !isatty.IsTerminal(os.Stderr.Fd()) {
+		reporter = progress.NewLogReporter(progress.DefaultLogInterval)
+	}
+
+	// The metrics see every event, however progress is shown
+	return runMetrics.Reporter(reporter)
+}
+
+// Get the download HTTP client options from the environment, or the config file
+func getDownloadClientOptions() (download.ClientOptions, error) {
+	cfg, err := settings()
+	if err != nil {
+		return download.ClientOptions{}, err
+	}
+
+	headers, err := download.ParseHeaders(cfg.Download.Headers)
+	if err != nil {
+		return download.ClientOptions{}, err
+	}
+
+	return download.ClientOptions{
+		ProxyUrl:       cfg.Download.ProxyUrl,
+		CaFile:         cfg.Download.CaFile,
+		ClientCertFile: cfg.Download.ClientCertFile,
+		ClientKeyFile:  cfg.Download.ClientKeyFile,
+		UserAgent:      cfg.Download.UserAgent,
+		Headers:        headers,
+	}, nil
+}
+
+// reportingHttpClient returns the HTTP client used to send notifications and metrics. It uses the same proxy,
+// certificates and user agent as downloads, without the download headers, which are usually credentials for the SRD
+// source.
+func reportingHttpClient() (*http.Client, error) {
+	clientOptions, err := getDownloadClientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	clientOptions.Headers = nil
+	return download.NewHttpClient(clientOptions)
+}
+
+// loadDotenvIfExists loads the .env file if there is one, for commands where it is optional
+func loadDotenvIfExists(envPath string) error {
+	if _, err := os.Stat(envPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	err := godotenv.Overload(envPath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load environment file")
+		return ErrCannotLoadDotenv
+	}
+
+	return nil
+}
+
+// databaseLock takes an advisory lock on the database being imported into, waiting up to the timeout for it
+func databaseLock(ctx context.Context, dbParams db.DatabaseConnectionParams, timeout time.Duration) (func(), error) {
+	name := db.ImportLockName(dbParams.Database)
+	if timeout > 0 {
+		log.Info().Msgf("waiting up to %v for database lock %v", timeout, name)
+	}
+
+	lock, err := db.NewAdvisoryLock(ctx, dbParams, name, timeout)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to acquire database lock")
+		return nil, err
+	}
+
+	log.Debug().Msgf("acquired database lock %v", name)
+	return func() {
+		err := lock.Release()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to release database lock")
+		}
 	}, nil
 }
 
-// processLock attempts to acquire a process lock to prevent multiple instances of the application running
-func processLock() (func(), error) {
-	lockfile, err := lock.NewLock()
-	if err == lock.ErrAlreadyLocked {
-		return nil, ErrAlreadyRunning
+// processLock attempts to acquire a process lock for a command to prevent multiple instances of the application
+// running against the same data directory, waiting up to the timeout for another instance to finish
+func processLock(ctx context.Context, dir string, command string, timeout time.Duration) (func(), error) {
+	var lockfile *lock.Lock
+	var err error
+	if timeout > 0 {
+		log.Info().Msgf("waiting up to %v for process lock in %v", timeout, dir)
+		lockfile, err = lock.WaitLock(ctx, dir, command, timeout)
+	} else {
+		lockfile, err = lock.NewLock(dir, command)
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return nil, err
+	} else if err == lock.ErrAlreadyLocked {
+		owner, _ := lock.ReadOwner(dir)
+		if owner == nil {
+			return nil, ErrAlreadyRunning
+		}
+
+		log.Error().Msgf("process lock is held by %v", owner)
+		return nil, fmt.Errorf("%w: %v", ErrAlreadyRunning, owner)
 	} else if err != nil {
+		log.Error().Err(err).Msg("failed to acquire process lock")
 		return nil, ErrFailedProcessLock
 	}
 
+	if owner := lockfile.StaleOwner(); owner != nil {
+		log.Warn().Msgf("took over a stale process lock left by %v, which did not exit cleanly", owner)
+	}
+
 	return func() {
 		err := lockfile.Unlock()
 		if err != nil {
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -12,7 +13,9 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/require"
@@ -20,7 +23,10 @@ import (
 
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/cli"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/config"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/db"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/download"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/lock"
 	"github.com/VATSIM-UK/ukcp-srd-tools/test/logging"
 )
 
@@ -28,16 +34,19 @@ func TestRun_Airac(t *testing.T) {
 	require := require.New(t)
 
 	// Run the CLI test
-	test := runCliTest(t, []string{"cmd", "airac"})
+	var test *cliTest
+	output := captureStdout(t, func() {
+		test = runCliTest(t, []string{"cmd", "airac"})
+	})
 	require.NoError(test.testError)
 
 	currentAirac := airac.NewAirac(nil)
 	currentCycle := currentAirac.CurrentCycle()
 	nextCycle := currentAirac.NextCycle()
 
-	airacString := func(cycleName string, cycle *airac.AiracCycle) string {
+	airacRow := func(cycleName string, cycle *airac.AiracCycle) string {
 		return fmt.Sprintf(
-			"%s AIRAC cycle is %v (%v - %v)",
+			"%-9s%v   %v  %v",
 			cycleName,
 			cycle.Ident,
 			cycle.Start.Format("2006-01-02"),
@@ -45,9 +54,523 @@ func TestRun_Airac(t *testing.T) {
 		)
 	}
 
-	// Check the logs
-	test.logRecorder.AssertHasString(require, airacString("Current", currentCycle))
-	test.logRecorder.AssertHasString(require, airacString("Next", nextCycle))
+	// The cycles are written to stdout as a table, not logged
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	require.Equal([]string{
+		"CYCLE    IDENT  START       END",
+		airacRow("Current", currentCycle),
+		airacRow("Next", nextCycle),
+	}, lines)
+
+	for _, line := range test.logRecorder.Logs() {
+		require.NotContains(line, "AIRAC cycle is")
+	}
+}
+
+func TestRun_AiracDate(t *testing.T) {
+	require := require.New(t)
+
+	var test *cliTest
+	output := captureStdout(t, func() {
+		test = runCliTest(t, []string{"cmd", "airac", "--date", "2025-03-01"})
+	})
+	require.NoError(test.testError)
+
+	require.Equal(`CYCLE          IDENT  START       END
+On 2025-03-01  2502   2025-02-20  2025-03-20
+Next           2503   2025-03-20  2025-04-17
+`, output)
+}
+
+func TestRun_AiracInvalidDate(t *testing.T) {
+	test := runCliTest(t, []string{"cmd", "airac", "--date", "01/03/2025"})
+	require.ErrorIs(t, test.testError, cli.ErrInvalidDate)
+}
+
+func TestRun_AiracJson(t *testing.T) {
+	require := require.New(t)
+
+	var test *cliTest
+	output := captureStdout(t, func() {
+		test = runCliTest(t, []string{"cmd", "airac", "--date", "2025-03-01", "--format", "json"})
+	})
+	require.NoError(test.testError)
+
+	require.JSONEq(`{
+		"cycle": {"ident": "2502", "start": "2025-02-20", "end": "2025-03-20"},
+		"next": {"ident": "2503", "start": "2025-03-20", "end": "2025-04-17"}
+	}`, output)
+}
+
+func TestRun_AiracList(t *testing.T) {
+	require := require.New(t)
+
+	var test *cliTest
+	output := captureStdout(t, func() {
+		test = runCliTest(t, []string{"cmd", "airac", "list", "--year", "2026"})
+	})
+	require.NoError(test.testError)
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	require.Len(lines, 14)
+	require.Equal("IDENT  START       END", lines[0])
+	require.Equal("2601   2026-01-22  2026-02-19", lines[1])
+	require.Equal("2613   2026-12-24  2027-01-21", lines[13])
+}
+
+func TestRun_AiracListJson(t *testing.T) {
+	require := require.New(t)
+
+	var test *cliTest
+	output := captureStdout(t, func() {
+		test = runCliTest(t, []string{"cmd", "airac", "--format", "json", "list", "--year", "2020"})
+	})
+	require.NoError(test.testError)
+
+	cycles := make([]map[string]string, 0)
+	require.NoError(json.Unmarshal([]byte(output), &cycles))
+	require.Len(cycles, 14)
+	require.Equal(map[string]string{"ident": "2014", "start": "2020-12-31", "end": "2021-01-28"}, cycles[13])
+}
+
+func TestRun_AiracIcs(t *testing.T) {
+	require := require.New(t)
+
+	var test *cliTest
+	output := captureStdout(t, func() {
+		test = runCliTest(t, []string{"cmd", "airac", "ics", "--year", "2025", "--year", "2026"})
+	})
+	require.NoError(test.testError)
+
+	require.True(strings.HasPrefix(output, "BEGIN:VCALENDAR\r\n"))
+	require.Equal(26, strings.Count(output, "BEGIN:VEVENT"))
+	require.Contains(output, "DTSTART;VALUE=DATE:20250123\r\n")
+	require.Contains(output, "DTSTART;VALUE=DATE:20261224\r\n")
+}
+
+func TestRun_AiracNow(t *testing.T) {
+	require := require.New(t)
+
+	var test *cliTest
+	output := captureStdout(t, func() {
+		test = runCliTest(t, []string{"cmd", "--now", "2026-01-22T00:00:00Z", "airac"})
+	})
+	require.NoError(test.testError)
+
+	test.logRecorder.AssertHasString(require, "Simulating the current time as 2026-01-22T00:00:00Z")
+	require.Contains(output, "Current  2601   2026-01-22  2026-02-19\n")
+	require.Contains(output, "Next     2602   2026-02-19  2026-03-19\n")
+}
+
+func TestRun_AiracNowFromEnv(t *testing.T) {
+	require := require.New(t)
+	t.Setenv("SRD_NOW", "2026-01-21")
+
+	var test *cliTest
+	output := captureStdout(t, func() {
+		test = runCliTest(t, []string{"cmd", "airac"})
+	})
+	require.NoError(test.testError)
+
+	require.Contains(output, "Current  2513   2025-12-25  2026-01-22\n")
+	require.Contains(output, "Next     2601   2026-01-22  2026-02-19\n")
+}
+
+func TestRun_InvalidNow(t *testing.T) {
+	test := runCliTest(t, []string{"cmd", "--now", "22/01/2026", "airac"})
+	require.ErrorIs(t, test.testError, cli.ErrInvalidNow)
+}
+
+func TestRun_AiracIcsNow(t *testing.T) {
+	require := require.New(t)
+
+	var test *cliTest
+	output := captureStdout(t, func() {
+		test = runCliTest(t, []string{"cmd", "--now", "2020-06-01T12:30:00Z", "airac", "ics"})
+	})
+	require.NoError(test.testError)
+
+	// Defaults to the simulated year and the one after it, stamped with the simulated time
+	require.Equal(27, strings.Count(output, "BEGIN:VEVENT"))
+	require.Contains(output, "UID:airac-2001@ukcp-srd-tools.vatsim.uk\r\n")
+	require.Contains(output, "UID:airac-2113@ukcp-srd-tools.vatsim.uk\r\n")
+	require.Contains(output, "DTSTAMP:20200601T123000Z\r\n")
+}
+
+func TestRun_Check(t *testing.T) {
+	tests := []struct {
+		name           string
+		now            string
+		loaded         string
+		stageNext      bool
+		extraArgs      []string
+		expectedCode   int
+		expectedOutput string
+	}{
+		{
+			name:           "nothing loaded",
+			now:            "2026-02-10",
+			expectedCode:   2,
+			expectedOutput: "SRD CRITICAL - no AIRAC cycle is loaded, current cycle is 2601 | days_until_next=9;7\n",
+		},
+		{
+			name:           "loaded cycle is out of date",
+			now:            "2026-02-10",
+			loaded:         "2513",
+			expectedCode:   2,
+			expectedOutput: "SRD CRITICAL - loaded AIRAC cycle 2513 is out of date, current cycle 2601 started 2026-01-22 | days_until_next=9;7\n",
+		},
+		{
+			name:           "loaded cycle is current",
+			now:            "2026-02-10",
+			loaded:         "2601",
+			expectedCode:   0,
+			expectedOutput: "SRD OK - loaded AIRAC cycle 2601 is current | days_until_next=9;7\n",
+		},
+		{
+			name:           "next cycle is close and not staged",
+			now:            "2026-02-15",
+			loaded:         "2601",
+			expectedCode:   1,
+			expectedOutput: "SRD WARNING - loaded AIRAC cycle 2601 is current, but cycle 2602 starts 2026-02-19 and has not been staged | days_until_next=4;7\n",
+		},
+		{
+			name:           "next cycle is close and staged",
+			now:            "2026-02-15",
+			loaded:         "2601",
+			stageNext:      true,
+			expectedCode:   0,
+			expectedOutput: "SRD OK - loaded AIRAC cycle 2601 is current | days_until_next=4;7\n",
+		},
+		{
+			name:           "next cycle is outside the warning window",
+			now:            "2026-02-15",
+			loaded:         "2601",
+			extraArgs:      []string{"--warn-days", "3"},
+			expectedCode:   0,
+			expectedOutput: "SRD OK - loaded AIRAC cycle 2601 is current | days_until_next=4;3\n",
+		},
+		{
+			name:           "loaded cycle is ahead",
+			now:            "2026-02-10",
+			loaded:         "2602",
+			expectedCode:   1,
+			expectedOutput: "SRD WARNING - loaded AIRAC cycle 2602 is ahead of the current cycle 2601 | days_until_next=9;7\n",
+		},
+		{
+			name:           "loaded cycle is invalid",
+			now:            "2026-02-10",
+			loaded:         "2699",
+			expectedCode:   3,
+			expectedOutput: "SRD UNKNOWN - loaded AIRAC cycle \"2699\" is not valid | days_until_next=9;7\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			test := getCliTest(t, append([]string{"cmd", "--now", tt.now, "check"}, tt.extraArgs...))
+
+			if tt.loaded != "" {
+				require.NoError(os.WriteFile(filepath.Join(test.tempDir, "ukcp-srd-import-loaded-cycle"), []byte(tt.loaded), 0600))
+			}
+
+			if tt.stageNext {
+				require.NoError(os.WriteFile(filepath.Join(test.tempDir, "ukcp-srd-import-staged-2602.xlsx"), []byte("staged"), 0600))
+			}
+
+			output := captureStdout(t, func() {
+				test.testError = cli.Run(test.tempDir)
+			})
+			require.Equal(tt.expectedOutput, output)
+
+			if tt.expectedCode == 0 {
+				require.NoError(test.testError)
+				return
+			}
+
+			var exitErr *cli.ExitError
+			require.ErrorAs(test.testError, &exitErr)
+			require.Equal(tt.expectedCode, exitErr.Code)
+		})
+	}
+}
+
+func TestRun_CheckJson(t *testing.T) {
+	require := require.New(t)
+	test := getCliTest(t, []string{"cmd", "--now", "2026-02-15", "check", "--format", "json"})
+	require.NoError(os.WriteFile(filepath.Join(test.tempDir, "ukcp-srd-import-loaded-cycle"), []byte("2601"), 0600))
+
+	output := captureStdout(t, func() {
+		test.testError = cli.Run(test.tempDir)
+	})
+
+	var exitErr *cli.ExitError
+	require.ErrorAs(test.testError, &exitErr)
+	require.Equal(1, exitErr.Code)
+
+	require.JSONEq(`{
+		"status": "WARNING",
+		"code": 1,
+		"message": "loaded AIRAC cycle 2601 is current, but cycle 2602 starts 2026-02-19 and has not been staged",
+		"loaded": {"ident": "2601", "start": "2026-01-22", "end": "2026-02-19"},
+		"current": {"ident": "2601", "start": "2026-01-22", "end": "2026-02-19"},
+		"next": {"ident": "2602", "start": "2026-02-19", "end": "2026-03-19"},
+		"next_staged": false,
+		"days_until_next": 4
+	}`, output)
+}
+
+func TestRun_DataDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		useFlag bool
+	}{
+		{
+			name:    "flag",
+			useFlag: true,
+		},
+		{
+			name:    "environment variable",
+			useFlag: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+
+			// The data directory doesn't exist yet, so is created
+			dataDir := filepath.Join(t.TempDir(), "nested", "data")
+			args := []string{"cmd", "loaded"}
+			if tt.useFlag {
+				args = []string{"cmd", "--data-dir", dataDir, "loaded"}
+			} else {
+				t.Setenv("SRD_DATA_DIR", dataDir)
+			}
+
+			test := runCliTest(t, args)
+			require.NoError(test.testError)
+			test.logRecorder.AssertHasString(require, "No AIRAC cycle loaded")
+
+			info, err := os.Stat(dataDir)
+			require.NoError(err)
+			require.True(info.IsDir())
+
+			// State is read from the data directory, rather than the default one
+			require.NoError(os.WriteFile(filepath.Join(dataDir, "ukcp-srd-import-loaded-cycle"), []byte("2403"), 0600))
+
+			test = runCliTest(t, args)
+			require.NoError(test.testError)
+			test.logRecorder.AssertHasString(require, "Loaded AIRAC cycle is 2403 (2024-03-21 - 2024-04-18)")
+		})
+	}
+}
+
+func TestRun_InvalidDataDir(t *testing.T) {
+	// A file can't be used as the data directory
+	notADir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notADir, []byte("file"), 0600))
+
+	test := runCliTest(t, []string{"cmd", "--data-dir", filepath.Join(notADir, "data"), "loaded"})
+	require.ErrorIs(t, test.testError, cli.ErrInvalidDataDir)
+}
+
+func TestDefaultDataDir(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/var/lib/state")
+	require.Equal(t, "/var/lib/state/ukcp-srd-tools", cli.DefaultDataDir())
+
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("HOME", "/home/srd")
+	require.Equal(t, "/home/srd/.local/state/ukcp-srd-tools", cli.DefaultDataDir())
+}
+
+func TestRun_ImportAlreadyRunning(t *testing.T) {
+	require := require.New(t)
+	test := getCliTest(t, []string{"cmd", "--wait", "300ms", "import", "2404", testDataFile("simple1.xlsx")})
+
+	// Another process is using the data directory
+	held, err := lock.NewLock(test.tempDir, "import")
+	require.NoError(err)
+	defer held.Unlock()
+
+	test.testError = cli.Run(test.tempDir)
+	require.ErrorIs(test.testError, cli.ErrAlreadyRunning)
+	test.logRecorder.AssertHasString(require, "waiting up to 300ms for process lock in "+test.tempDir)
+	test.logRecorder.AssertHasString(require, fmt.Sprintf("process lock is held by PID %d on", os.Getpid()))
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	require := require.New(t)
+	test := getCliTest(t, []string{"cmd", "--wait", "5s", "import", "2404", testDataFile("simple1.xlsx")})
+
+	// Another process is using the data directory, so the import waits until it is cancelled
+	held, err := lock.NewLock(test.tempDir, "import")
+	require.NoError(err)
+	defer held.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	test.testError = cli.RunContext(ctx, test.tempDir)
+	require.ErrorIs(test.testError, cli.ErrCancelled)
+	test.logRecorder.AssertHasString(require, "cancelled before finishing")
+}
+
+func TestRun_LockStatus(t *testing.T) {
+	require := require.New(t)
+	test := runCliTest(t, []string{"cmd", "lock", "status"})
+	require.NoError(test.testError)
+	test.logRecorder.AssertHasString(require, "Process lock is not held")
+
+	held, err := lock.NewLock(test.tempDir, "import")
+	require.NoError(err)
+
+	test = getCliTestWithTempDir([]string{"cmd", "lock", "status"}, test.tempDir)
+	require.NoError(cli.Run(test.tempDir))
+	test.logRecorder.AssertHasString(require, fmt.Sprintf("Process lock is held by PID %d on", os.Getpid()))
+
+	require.NoError(held.Unlock())
+}
+
+func TestRun_LockStatusStale(t *testing.T) {
+	require := require.New(t)
+	test := getCliTest(t, []string{"cmd", "lock", "status", "--format", "json"})
+
+	// A process that no longer exists didn't clean up after itself
+	hostname, err := os.Hostname()
+	require.NoError(err)
+	owner := fmt.Sprintf(`{"pid":99999999,"hostname":%q,"command":"import","started_at":"2024-04-18T00:00:00Z"}`, hostname)
+	require.NoError(os.WriteFile(filepath.Join(test.tempDir, "ukcp-srd-import.lock.json"), []byte(owner), 0600))
+
+	output := captureStdout(t, func() {
+		test.testError = cli.Run(test.tempDir)
+	})
+	require.NoError(test.testError)
+
+	require.JSONEq(fmt.Sprintf(`{
+		"locked": false,
+		"stale": true,
+		"owner": {"pid": 99999999, "hostname": %q, "command": "import", "started_at": "2024-04-18T00:00:00Z"}
+	}`, hostname), output)
+
+	// The next run takes over the stale lock and says so
+	test = getCliTestWithTempDir([]string{"cmd", "import", "2404", testDataFile("simple1.xlsx"), "--env-path", "missing.env"}, test.tempDir)
+	require.ErrorIs(cli.Run(test.tempDir), cli.ErrCannotLoadDotenv)
+	test.logRecorder.AssertHasString(require, "took over a stale process lock left by PID 99999999 on "+hostname)
+}
+
+func TestRun_LockStatusOtherHost(t *testing.T) {
+	require := require.New(t)
+	test := getCliTest(t, []string{"cmd", "lock", "status"})
+
+	// The owner can't be checked from here, so is assumed to still hold the lock
+	owner := `{"pid":99999999,"hostname":"another-host.invalid","command":"import","started_at":"2024-04-18T00:00:00Z"}`
+	require.NoError(os.WriteFile(filepath.Join(test.tempDir, "ukcp-srd-import.lock.json"), []byte(owner), 0600))
+
+	require.NoError(cli.Run(test.tempDir))
+	test.logRecorder.AssertHasString(require, "Process lock is held by PID 99999999 on another-host.invalid (import) since 2024-04-18T00:00:00Z, which is on another host so can't be checked")
+}
+
+func TestRun_ConfigShow(t *testing.T) {
+	require := require.New(t)
+	for _, name := range []string{"DB_HOST", "DB_PORT", "DB_DATABASE", "DB_USERNAME", "DB_PASSWORD", "DOWNLOAD_USER_AGENT"} {
+		t.Setenv(name, "")
+	}
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	require.NoError(os.WriteFile(configPath, []byte(`
+profile: staging
+data_dir: /nonexistent/srd
+database:
+  host: localhost
+  port: 3306
+  database: uk_plugin
+  username: srd
+profiles:
+  staging:
+    database:
+      password: staging-secret
+  production:
+    database:
+      host: production.db.internal
+      password: production-secret
+    download:
+      user_agent: srd-production
+    import:
+      thresholds:
+        max_route_drop_percent: 0
+`), 0600))
+
+	// The environment overrides the profile, and flags override both
+	envPath := filepath.Join(dir, "test.env")
+	require.NoError(os.WriteFile(envPath, []byte("DB_USERNAME=env-user\n"), 0600))
+	dataDir := filepath.Join(dir, "data")
+
+	test := getCliTest(t, []string{"cmd", "--config", configPath, "--profile", "production", "--data-dir", dataDir, "config", "show", "--env-path", envPath})
+	output := captureStdout(t, func() {
+		test.testError = cli.Run(test.tempDir)
+	})
+	require.NoError(test.testError)
+
+	require.Equal(fmt.Sprintf(`# Config file %v, profile production
+data_dir: %v
+database:
+    host: production.db.internal
+    port: "3306"
+    database: uk_plugin
+    username: env-user
+    password: <redacted>
+download:
+    user_agent: srd-production
+import:
+    thresholds:
+        max_route_drop_percent: 0
+`, configPath, dataDir), output)
+}
+
+func TestRun_ConfigShowWithoutConfigFile(t *testing.T) {
+	require := require.New(t)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, name := range []string{"DB_HOST", "DB_PORT", "DB_DATABASE", "DB_USERNAME", "DB_PASSWORD"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("DB_HOST", "env-host")
+
+	test := getCliTest(t, []string{"cmd", "config", "show", "--env-path", "missing.env"})
+	output := captureStdout(t, func() {
+		test.testError = cli.Run(test.tempDir)
+	})
+	require.NoError(test.testError)
+
+	require.Equal(fmt.Sprintf("# No config file\ndata_dir: %v\ndatabase:\n    host: env-host\n", test.tempDir), output)
+}
+
+func TestRun_ConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("profiles:\n  staging: {}\n"), 0600))
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown profile", []string{"cmd", "--config", configPath, "--profile", "production", "loaded"}},
+		{"missing config file", []string{"cmd", "--config", filepath.Join(dir, "missing.yaml"), "loaded"}},
+		{"profile without config file", []string{"cmd", "--profile", "staging", "loaded"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := runCliTest(t, tt.args)
+			require.ErrorIs(t, test.testError, cli.ErrCannotLoadConfig)
+		})
+	}
 }
 
 func TestRun_Parse(t *testing.T) {
@@ -132,6 +655,58 @@ func TestRun_Loaded(t *testing.T) {
 	test.logRecorder.AssertHasString(require, "Loaded AIRAC cycle is 2403 (2024-03-21 - 2024-04-18)")
 }
 
+func TestRun_LoadedWithState(t *testing.T) {
+	test := getCliTest(t, []string{"cmd", "loaded"})
+	require := require.New(t)
+
+	loaded, err := airac.NewLoadedAirac(test.tempDir)
+	require.NoError(err)
+	err = loaded.SetState(airac.LoadedState{
+		Ident:           "2403",
+		ImportedAt:      time.Date(2024, time.March, 21, 10, 0, 0, 0, time.UTC),
+		SourceFile:      "/tmp/ukcp-srd-import-loaded-download.xlsx",
+		SourceChecksum:  "abc123",
+		SourceUrl:       "https://example.com/srd.zip",
+		RouteCount:      100,
+		RouteErrorCount: 1,
+		NoteCount:       10,
+		NoteErrorCount:  2,
+		ToolVersion:     "v1.2.3",
+	})
+	require.NoError(err)
+	require.NoError(loaded.Close())
+
+	test.testError = cli.Run(test.tempDir)
+	require.NoError(test.testError)
+
+	test.logRecorder.AssertHasString(require, "Loaded AIRAC cycle is 2403 (2024-03-21 - 2024-04-18)")
+	test.logRecorder.AssertHasString(require, "Imported at 2024-03-21T10:00:00Z")
+	test.logRecorder.AssertHasString(require, "Imported from file /tmp/ukcp-srd-import-loaded-download.xlsx (sha256 abc123)")
+	test.logRecorder.AssertHasString(require, "Downloaded from https://example.com/srd.zip")
+	test.logRecorder.AssertHasString(require, "processed 100 routes with 1 errors")
+	test.logRecorder.AssertHasString(require, "processed 10 notes with 2 errors")
+	test.logRecorder.AssertHasString(require, "Imported by ukcp-srd-tools v1.2.3")
+}
+
+func TestRun_LoadedOldFormat(t *testing.T) {
+	test := getCliTest(t, []string{"cmd", "loaded"})
+	require := require.New(t)
+
+	// Older versions wrote just the ident
+	require.NoError(os.WriteFile(filepath.Join(test.tempDir, "ukcp-srd-import-loaded-cycle"), []byte("2403"), 0600))
+
+	test.testError = cli.Run(test.tempDir)
+	require.NoError(test.testError)
+
+	test.logRecorder.AssertHasString(require, "Loaded AIRAC cycle is 2403 (2024-03-21 - 2024-04-18)")
+
+	// Nothing else was recorded, so nothing else is printed
+	for _, line := range test.logRecorder.Logs() {
+		require.NotContains(line, "Imported")
+		require.NotContains(line, "processed")
+	}
+}
+
 func TestRun_LoadedNoCycleLoaded(t *testing.T) {
 	require := require.New(t)
 
@@ -143,6 +718,21 @@ func TestRun_LoadedNoCycleLoaded(t *testing.T) {
 	test.logRecorder.AssertHasString(require, "No AIRAC cycle loaded")
 }
 
+func TestRun_LoadedInvalidDatabaseSettings(t *testing.T) {
+	require := require.New(t)
+	for _, name := range []string{"DB_HOST", "DB_DATABASE", "DB_USERNAME", "DB_PASSWORD"} {
+		t.Setenv(name, "")
+	}
+
+	// A database that is configured but can't be used is an error, rather than being silently skipped
+	t.Setenv("DB_PORT", "invalid")
+
+	test := runCliTest(t, []string{"cmd", "loaded"})
+	require.ErrorIs(test.testError, cli.ErrPortInvalid)
+	test.logRecorder.AssertHasString(require, "No AIRAC cycle loaded")
+	test.logRecorder.AssertHasString(require, "invalid database port")
+}
+
 type importTest struct {
 	name                string
 	filename            string
@@ -260,6 +850,19 @@ func TestRun_ImportErrors(t *testing.T) {
 				"missing database name",
 			},
 		},
+		{
+			"env file with socket missing user",
+			"simple1.xlsx",
+			"socket-missing-user.env",
+			map[string]string{
+				"DB_SOCKET":   "/var/run/mysqld/mysqld.sock",
+				"DB_DATABASE": "name",
+			},
+			cli.ErrMissingUser,
+			[]string{
+				"missing database user",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -303,6 +906,80 @@ func TestRun_ImportErrors(t *testing.T) {
 
 }
 
+func TestRun_ImportDatabaseSettingErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		expectedErr error
+	}{
+		{
+			name:        "invalid dsn",
+			env:         map[string]string{"DB_DSN": "not a dsn"},
+			expectedErr: db.ErrInvalidDsn,
+		},
+		{
+			name:        "dsn without a database",
+			env:         map[string]string{"DB_DSN": "user:pass@tcp(localhost:3306)/"},
+			expectedErr: cli.ErrMissingDatabase,
+		},
+		{
+			name:        "missing dsn file",
+			env:         map[string]string{"DB_DSN_FILE": "/nonexistent/dsn"},
+			expectedErr: config.ErrCannotReadSecret,
+		},
+		{
+			name: "missing password file",
+			env: map[string]string{
+				"DB_HOST":          "localhost",
+				"DB_PORT":          "3306",
+				"DB_USERNAME":      "user",
+				"DB_DATABASE":      "name",
+				"DB_PASSWORD_FILE": "/nonexistent/password",
+			},
+			expectedErr: config.ErrCannotReadSecret,
+		},
+		{
+			name: "invalid tls mode",
+			env: map[string]string{
+				"DB_HOST":     "localhost",
+				"DB_PORT":     "3306",
+				"DB_USERNAME": "user",
+				"DB_DATABASE": "name",
+				"DB_PASSWORD": "passwd",
+				"DB_TLS_MODE": "sometimes",
+			},
+			expectedErr: db.ErrInvalidTlsMode,
+		},
+		{
+			name: "invalid timeout",
+			env: map[string]string{
+				"DB_HOST":     "localhost",
+				"DB_PORT":     "3306",
+				"DB_USERNAME": "user",
+				"DB_DATABASE": "name",
+				"DB_PASSWORD": "passwd",
+				"DB_TIMEOUT":  "soon",
+			},
+			expectedErr: config.ErrInvalidEnv,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			defer resetEnv()
+
+			testDir := t.TempDir()
+			envFilePath := filepath.Join(testDir, "test.env")
+			require.NoError(godotenv.Write(tt.env, envFilePath))
+
+			test := getCliTestWithTempDir([]string{"cmd", "import", "2404", testDataFile("simple1.xlsx"), "--env-path", envFilePath}, testDir)
+			test.testError = cli.Run(testDir)
+			require.ErrorIs(test.testError, tt.expectedErr)
+		})
+	}
+}
+
 func TestRun_ImportSuccess(t *testing.T) {
 	tests := []struct {
 		name                string
@@ -383,6 +1060,16 @@ func TestRun_ImportSuccess(t *testing.T) {
 			require.NoError(err)
 			require.Equal("2404", loaded.Ident())
 
+			// Check the details of the import were recorded
+			state := loaded.State()
+			require.False(state.ImportedAt.IsZero())
+			require.Equal(testDataFile(tt.filename), state.SourceFile)
+			require.Len(state.SourceChecksum, 64)
+			require.Empty(state.SourceUrl)
+			require.Equal(3, state.RouteCount)
+			require.Equal(3, state.NoteCount)
+			require.NotEmpty(state.ToolVersion)
+
 			// Close the loaded file
 			require.NoError(loaded.Close())
 
@@ -410,6 +1097,13 @@ func TestRun_ImportSuccess(t *testing.T) {
 			require.NoError(err)
 			require.Equal(3, noteCount)
 
+			// Check the import was recorded alongside the data
+			dbState, found, err := db.LoadedState(context.Background())
+			require.NoError(err)
+			require.True(found)
+			require.Equal("2404", dbState.Ident)
+			require.Equal(testDataFile(tt.filename), dbState.SourceFile)
+
 			// Terminate the database
 			mysqlContainer.terminateFunc()
 
@@ -419,6 +1113,68 @@ func TestRun_ImportSuccess(t *testing.T) {
 	}
 }
 
+func TestRun_ImportDatabaseLocked(t *testing.T) {
+	require := require.New(t)
+
+	testDir := t.TempDir()
+	envFilePath := fmt.Sprintf("%s/%s", testDir, "test.env")
+
+	// Create the database
+	ctx := context.Background()
+	mysqlContainer, err := getMysqlContainer(ctx, t)
+	require.NoError(err)
+	defer mysqlContainer.terminateFunc()
+
+	containerHost, err := mysqlContainer.container.Host(ctx)
+	require.NoError(err)
+
+	containerPort, err := mysqlContainer.container.MappedPort(ctx, "3306")
+	require.NoError(err)
+
+	err = godotenv.Write(
+		map[string]string{
+			"DB_HOST":     containerHost,
+			"DB_PORT":     containerPort.Port(),
+			"DB_USERNAME": TestUsername,
+			"DB_DATABASE": TestDatabase,
+			"DB_PASSWORD": TestPassword,
+		},
+		envFilePath,
+	)
+	require.NoError(err)
+	defer resetEnv()
+
+	// Another host is importing
+	lock, err := db.NewAdvisoryLock(ctx, db.DatabaseConnectionParams{
+		Host:     containerHost,
+		Port:     containerPort.Int(),
+		Username: TestUsername,
+		Password: TestPassword,
+		Database: TestDatabase,
+	}, db.ImportLockName(TestDatabase), 0)
+	require.NoError(err)
+
+	test := getCliTestWithTempDir([]string{"cmd", "--db-lock-timeout", "1s", "import", "2404", testDataFile("simple1.xlsx"), "--env-path", envFilePath}, testDir)
+	err = cli.Run(testDir)
+	require.ErrorIs(err, db.ErrDatabaseLocked)
+	test.logRecorder.AssertHasString(require, "waiting up to 1s for database lock ukcp-srd-tools:import:uk_plugin")
+
+	var lockedErr *db.LockedError
+	require.ErrorAs(err, &lockedErr)
+	require.NotNil(lockedErr.Holder)
+
+	// Nothing should have been imported
+	loaded, err := airac.NewLoadedAirac(testDir)
+	require.NoError(err)
+	require.Equal("", loaded.Ident())
+
+	// Once the other host is done, the import can go ahead
+	require.NoError(lock.Release())
+	test = getCliTestWithTempDir([]string{"cmd", "import", "2404", testDataFile("simple1.xlsx"), "--env-path", envFilePath}, testDir)
+	require.NoError(cli.Run(testDir))
+	test.logRecorder.AssertHasString(require, "imported SRD for cycle 2404")
+}
+
 type downloadTest struct {
 	name                string
 	filename            string
@@ -611,6 +1367,282 @@ func TestDownload_Errors(t *testing.T) {
 
 }
 
+func TestDownload_Check(t *testing.T) {
+	tests := []struct {
+		name                string
+		responseCode        int
+		expectedLogMessages []string
+	}{
+		{
+			name:         "available",
+			responseCode: 200,
+			expectedLogMessages: []string{
+				"is available at",
+			},
+		},
+		{
+			name:         "not yet available",
+			responseCode: 404,
+			expectedLogMessages: []string{
+				"is not yet available at",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+
+			ts := getTestServer(tt.responseCode, testDataFile("simple1.xlsx"))
+			defer ts.server.Close()
+
+			// No env file is needed to check availability
+			test := runCliTest(t, []string{"cmd", "download", "--next", "--check", "--url", ts.server.URL})
+			require.NoError(test.testError)
+
+			for _, msg := range tt.expectedLogMessages {
+				test.logRecorder.AssertHasString(require, msg)
+			}
+
+			// Nothing should be staged
+			nextCycle := airac.NewAirac(nil).NextCycle()
+			_, ok := download.StagedFile(test.tempDir, nextCycle.Ident)
+			require.False(ok)
+		})
+	}
+}
+
+func TestDownload_Next(t *testing.T) {
+	require := require.New(t)
+
+	ts := getTestServer(200, testDataFile("simple1.xlsx"))
+	defer ts.server.Close()
+
+	// No env file is needed to stage the next cycle
+	test := runCliTest(t, []string{"cmd", "download", "--next", "--url", ts.server.URL})
+	require.NoError(test.testError)
+
+	nextCycle := airac.NewAirac(nil).NextCycle()
+	stagedPath, ok := download.StagedFile(test.tempDir, nextCycle.Ident)
+	require.True(ok)
+	test.logRecorder.AssertHasString(require, "staged SRD for cycle "+nextCycle.Ident)
+
+	// The loaded cycle should be untouched
+	loaded, err := airac.NewLoadedAirac(test.tempDir)
+	require.NoError(err)
+	require.Equal("", loaded.Ident())
+	require.NoError(loaded.Close())
+
+	// Running again should report that it's already staged
+	test = getCliTestWithTempDir([]string{"cmd", "download", "--next", "--url", ts.server.URL}, test.tempDir)
+	require.ErrorIs(cli.Run(test.tempDir), cli.ErrAlreadyStaged)
+
+	_, err = os.Stat(stagedPath)
+	require.NoError(err)
+}
+
+func TestDownload_NextNotYetAvailable(t *testing.T) {
+	require := require.New(t)
+
+	ts := getTestServer(404, testDataFile("simple1.xlsx"))
+	defer ts.server.Close()
+
+	test := runCliTest(t, []string{"cmd", "download", "--next", "--url", ts.server.URL})
+	require.ErrorIs(test.testError, download.ErrNotYetAvailable)
+
+	// Only the availability check should have been made
+	require.Equal(1, ts.callCount)
+}
+
+func TestDownload_NextWithNow(t *testing.T) {
+	require := require.New(t)
+
+	ts := getTestServer(200, testDataFile("simple1.xlsx"))
+	defer ts.server.Close()
+
+	// The day before the changeover, the next cycle is the one starting tomorrow
+	test := runCliTest(t, []string{"cmd", "--now", "2026-01-21", "download", "--next", "--url", ts.server.URL})
+	require.NoError(test.testError)
+
+	_, ok := download.StagedFile(test.tempDir, "2601")
+	require.True(ok)
+	test.logRecorder.AssertHasString(require, "staged SRD for cycle 2601")
+}
+
+func TestDownload_Metrics(t *testing.T) {
+	require := require.New(t)
+
+	ts := getTestServer(200, testDataFile("simple1.xlsx"))
+	defer ts.server.Close()
+
+	// A stub Pushgateway, recording what was pushed
+	pushed := make(map[string]string)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pushed[r.Method+" "+r.URL.Path] = string(body)
+	}))
+	defer gateway.Close()
+
+	textfileDir := t.TempDir()
+	test := runCliTest(t, []string{"cmd", "--metrics-textfile-dir", textfileDir, "--metrics-push-url", gateway.URL, "download", "--next", "--url", ts.server.URL})
+	require.NoError(test.testError)
+
+	content, err := os.ReadFile(filepath.Join(textfileDir, "ukcp_srd_tools_download.prom"))
+	require.NoError(err)
+	require.Contains(string(content), `ukcp_srd_last_run_success{command="download"} 1`)
+	require.Contains(string(content), `ukcp_srd_stage_duration_seconds{command="download",stage="download"}`)
+	require.Regexp(`ukcp_srd_download_bytes\{command="download"\} [1-9]`, string(content))
+
+	// The Pushgateway adds the command label itself
+	require.Len(pushed, 1)
+	require.Contains(pushed["PUT /metrics/job/ukcp_srd_tools/command/download"], `ukcp_srd_last_run_success{command="download"} 1`)
+	require.Regexp(`ukcp_srd_download_bytes [1-9]`, pushed["PUT /metrics/job/ukcp_srd_tools/command/download"])
+
+	// The SRD not being published yet isn't a failure
+	notAvailable := getTestServer(404, testDataFile("simple1.xlsx"))
+	defer notAvailable.server.Close()
+
+	test = getCliTestWithTempDir([]string{"cmd", "--metrics-textfile-dir", textfileDir, "download", "--next", "--url", notAvailable.server.URL}, t.TempDir())
+	require.ErrorIs(cli.Run(test.tempDir), download.ErrNotYetAvailable)
+
+	content, err = os.ReadFile(filepath.Join(textfileDir, "ukcp_srd_tools_download.prom"))
+	require.NoError(err)
+	require.Contains(string(content), `ukcp_srd_last_run_success{command="download"} 1`)
+
+	// An import has its own file, so the download's metrics are kept
+	test = getCliTestWithTempDir([]string{"cmd", "--metrics-textfile-dir", textfileDir, "import", "2601", testDataFile("missing.xlsx")}, t.TempDir())
+	require.Error(cli.Run(test.tempDir))
+
+	content, err = os.ReadFile(filepath.Join(textfileDir, "ukcp_srd_tools_import.prom"))
+	require.NoError(err)
+	require.Contains(string(content), `ukcp_srd_last_run_success{command="import"} 0`)
+
+	content, err = os.ReadFile(filepath.Join(textfileDir, "ukcp_srd_tools_download.prom"))
+	require.NoError(err)
+	require.Contains(string(content), `ukcp_srd_last_run_success{command="download"} 1`)
+
+	// Nor is an unreachable Pushgateway
+	gateway.Close()
+	test = getCliTestWithTempDir([]string{"cmd", "--metrics-push-url", gateway.URL, "download", "--next", "--url", ts.server.URL}, t.TempDir())
+	require.NoError(cli.Run(test.tempDir))
+	test.logRecorder.AssertHasString(require, "failed to push metrics")
+}
+
+func TestRun_MetricsUseDownloadProxy(t *testing.T) {
+	require := require.New(t)
+
+	// A proxy that records the requests sent through it
+	proxied := make([]*http.Request, 0)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r)
+	}))
+	defer proxy.Close()
+
+	t.Setenv("DOWNLOAD_PROXY_URL", proxy.URL)
+	t.Setenv("DOWNLOAD_HEADERS", "Authorization: Bearer srd-token")
+
+	test := runCliTest(t, []string{"cmd", "--metrics-push-url", "http://pushgateway.invalid", "import", "2601", testDataFile("missing.xlsx")})
+	require.Error(test.testError)
+	require.Len(proxied, 1)
+	require.Equal("http://pushgateway.invalid/metrics/job/ukcp_srd_tools/command/import", proxied[0].URL.String())
+
+	// The download headers are credentials for the SRD source, so aren't sent elsewhere
+	require.Empty(proxied[0].Header.Get("Authorization"))
+}
+
+func TestRun_Notifications(t *testing.T) {
+	require := require.New(t)
+
+	// A webhook that records what it's sent
+	received := make([]map[string]any, 0)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		require.NoError(json.NewDecoder(r.Body).Decode(&payload))
+		received = append(received, payload)
+	}))
+	defer webhook.Close()
+
+	t.Setenv("NOTIFY_WEBHOOK_URL", webhook.URL)
+	t.Setenv("NOTIFY_WEBHOOK_EVENTS", "failure")
+
+	// A failed import
+	test := runCliTest(t, []string{"cmd", "import", "2601", testDataFile("missing.xlsx")})
+	require.Error(test.testError)
+	require.Len(received, 1)
+	require.Equal("failure", received[0]["event"])
+	require.Equal("import", received[0]["stage"])
+	require.Equal("SRD import for AIRAC cycle 2601 failed", received[0]["summary"])
+	require.Contains(received[0]["error"], "no such file or directory")
+
+	// A failed download
+	failing := getTestServer(500, testDataFile("simple1.xlsx"))
+	defer failing.server.Close()
+
+	test = runCliTest(t, []string{"cmd", "download", "--next", "--url", failing.server.URL})
+	require.Error(test.testError)
+	require.Len(received, 2)
+	require.Equal("download", received[1]["stage"])
+	require.Equal(airac.NewAirac(nil).NextCycle().Ident, received[1]["cycle"])
+
+	// The SRD not being published yet isn't a failure
+	notAvailable := getTestServer(404, testDataFile("simple1.xlsx"))
+	defer notAvailable.server.Close()
+
+	test = runCliTest(t, []string{"cmd", "download", "--next", "--url", notAvailable.server.URL})
+	require.ErrorIs(test.testError, download.ErrNotYetAvailable)
+	require.Len(received, 2)
+
+	// Nor is a webhook that can't be reached
+	webhook.Close()
+	test = runCliTest(t, []string{"cmd", "import", "2601", testDataFile("missing.xlsx")})
+	require.ErrorContains(test.testError, "no such file or directory")
+	test.logRecorder.AssertHasString(require, "failed to send notification")
+}
+
+func TestRun_NotificationsUseDownloadProxy(t *testing.T) {
+	require := require.New(t)
+
+	// A proxy that records the requests sent through it
+	proxied := make([]*http.Request, 0)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r)
+	}))
+	defer proxy.Close()
+
+	t.Setenv("DOWNLOAD_PROXY_URL", proxy.URL)
+	t.Setenv("DOWNLOAD_HEADERS", "Authorization: Bearer srd-token")
+	t.Setenv("NOTIFY_WEBHOOK_URL", "http://webhook.invalid/hook")
+
+	test := runCliTest(t, []string{"cmd", "import", "2601", testDataFile("missing.xlsx")})
+	require.Error(test.testError)
+	require.Len(proxied, 1)
+	require.Equal("http://webhook.invalid/hook", proxied[0].URL.String())
+	require.Equal(download.DefaultUserAgent, proxied[0].UserAgent())
+
+	// The download headers are credentials for the SRD source, so aren't sent elsewhere
+	require.Empty(proxied[0].Header.Get("Authorization"))
+}
+
+func TestDownload_Traces(t *testing.T) {
+	require := require.New(t)
+
+	ts := getTestServer(200, testDataFile("simple1.xlsx"))
+	defer ts.server.Close()
+
+	// A stub OTLP receiver
+	paths := make(chan string, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	}))
+	defer receiver.Close()
+
+	// The spans are sent when the command finishes
+	test := runCliTest(t, []string{"cmd", "--trace-endpoint", receiver.URL, "download", "--next", "--url", ts.server.URL})
+	require.NoError(test.testError)
+	require.Len(paths, 1)
+	require.Equal("/v1/traces", <-paths)
+}
+
 type downloadSuccessTest struct {
 	name                string
 	fileName            string
@@ -742,6 +1774,7 @@ func TestDownloadSuccess(t *testing.T) {
 			loaded, err := airac.NewLoadedAirac(testDir)
 			require.NoError(err)
 			require.Equal(cycle, loaded.Ident())
+			require.Equal(ts.server.URL, loaded.State().SourceUrl)
 
 			// Close the loaded file
 			require.NoError(loaded.Close())
@@ -831,6 +1864,30 @@ func getCliTestWithTempDir(args []string, tempDir string) *cliTest {
 	}
 }
 
+// captureStdout captures everything written to stdout while the function runs
+func captureStdout(t *testing.T, f func()) string {
+	reader, writer, err := os.Pipe()
+	require.NoError(t, err)
+
+	originalStdout := os.Stdout
+	os.Stdout = writer
+	defer func() {
+		os.Stdout = originalStdout
+	}()
+
+	// Read in the background so large outputs don't block the pipe
+	output := make(chan string)
+	go func() {
+		content, _ := io.ReadAll(reader)
+		output <- string(content)
+	}()
+
+	f()
+	require.NoError(t, writer.Close())
+
+	return <-output
+}
+
 // hijackArgs hijacks the os.Args to pretend we're running on the CLI
 // it returns a function that can be used to restore the original os.Args
 func hijackArgs(args []string) func() {
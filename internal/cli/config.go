@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog/log"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/config"
+)
+
+var ErrCannotLoadConfig = errors.New("failed to load config file")
+
+var (
+	// fileConfig is the config loaded from the config file and profile, before the environment and flags are applied
+	fileConfig config.Config
+
+	// configPath and configProfile are the config file and profile in use, empty if there isn't one
+	configPath    string
+	configProfile string
+)
+
+// configureConfig loads the config file given on the command line, or the default one if it exists
+func configureConfig(flagPath string, profile string) error {
+	fileConfig, configPath, configProfile = config.Config{}, "", ""
+
+	path := flagPath
+	if path == "" {
+		path = config.DefaultPath()
+		if _, err := os.Stat(path); path == "" || errors.Is(err, os.ErrNotExist) {
+			if profile != "" {
+				log.Error().Msgf("profile %v was chosen, but there is no config file", profile)
+				return ErrCannotLoadConfig
+			}
+
+			return nil
+		}
+	}
+
+	loaded, loadedProfile, err := config.Load(path, profile)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to load config file %v", path)
+		return fmt.Errorf("%w: %v", ErrCannotLoadConfig, err)
+	}
+
+	fileConfig, configPath, configProfile = loaded, path, loadedProfile
+	if configProfile == "" {
+		log.Debug().Msgf("Using config file %v", configPath)
+	} else {
+		log.Debug().Msgf("Using config file %v with profile %v", configPath, configProfile)
+	}
+
+	return nil
+}
+
+// settings returns the effective config. Command line flags take precedence, then environment variables
+// (including those in the .env file), then the config file profile, then the defaults.
+func settings() (config.Config, error) {
+	settings, err := fileConfig.ApplyEnv(os.LookupEnv)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read settings from the environment")
+		return config.Config{}, err
+	}
+
+	if CLI.DataDir != "" {
+		settings.DataDir = CLI.DataDir
+	}
+
+	if CLI.Download.UrlTemplate != "" {
+		settings.Download.UrlTemplate = CLI.Download.UrlTemplate
+	}
+
+	if CLI.Download.IndexUrl != "" {
+		settings.Download.IndexUrl = CLI.Download.IndexUrl
+	}
+
+	if CLI.Download.Discover {
+		settings.Download.Discover = true
+	}
+
+	return settings, nil
+}
+
+// loadDotenv loads the .env file, which is required unless a config file is in use
+func loadDotenv(envPath string) error {
+	if configPath != "" {
+		return loadDotenvIfExists(envPath)
+	}
+
+	err := godotenv.Overload(envPath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load environment file")
+		return ErrCannotLoadDotenv
+	}
+
+	return nil
+}
+
+// doConfigShow prints the effective config as YAML, with secrets redacted
+func doConfigShow(envPath string, dir string) error {
+	if err := loadDotenvIfExists(envPath); err != nil {
+		return err
+	}
+
+	settings, err := settings()
+	if err != nil {
+		return err
+	}
+
+	// The data directory has been resolved by now, so show where it actually is
+	settings.DataDir = dir
+
+	content, err := settings.Redacted().Yaml()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case configPath == "":
+		fmt.Fprintln(os.Stdout, "# No config file")
+	case configProfile == "":
+		fmt.Fprintf(os.Stdout, "# Config file %v\n", configPath)
+	default:
+		fmt.Fprintf(os.Stdout, "# Config file %v, profile %v\n", configPath, configProfile)
+	}
+
+	fmt.Fprint(os.Stdout, content)
+	return nil
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/lock"
+)
+
+// lockStatusJson is how the process lock status is presented in JSON output
+type lockStatusJson struct {
+	Locked bool           `json:"locked"`
+	Stale  bool           `json:"stale"`
+	Owner  *lockOwnerJson `json:"owner"`
+}
+
+type lockOwnerJson struct {
+	Pid       int    `json:"pid"`
+	Hostname  string `json:"hostname"`
+	Command   string `json:"command"`
+	StartedAt string `json:"started_at"`
+}
+
+// doLockStatus reports whether the process lock for the data directory is held, which process recorded that it
+// holds it, and whether that record was left behind by a process that is no longer running
+func doLockStatus(dir string, format string) error {
+	status, err := lock.GetStatus(dir)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read process lock status")
+		return err
+	}
+
+	if format == "json" {
+		output := lockStatusJson{Locked: status.Locked, Stale: status.Stale}
+		if status.Owner != nil {
+			output.Owner = &lockOwnerJson{
+				Pid:       status.Owner.Pid,
+				Hostname:  status.Owner.Hostname,
+				Command:   status.Owner.Command,
+				StartedAt: status.Owner.StartedAt.UTC().Format(time.RFC3339),
+			}
+		}
+
+		return writeJson(output)
+	}
+
+	switch {
+	case status.Locked && !status.Owner.OnThisHost():
+		log.Info().Msgf("Process lock is held by %v, which is on another host so can't be checked", status.Owner)
+	case status.Locked:
+		log.Info().Msgf("Process lock is held by %v", status.Owner)
+	case status.Owner != nil:
+		log.Warn().Msgf("Process lock is not held, but a stale lock was left by %v, it will be taken over by the next run", status.Owner)
+	default:
+		log.Info().Msgf("Process lock is not held")
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/metrics"
+)
+
+// metricsPushTimeout is how long pushing metrics may take, so that an unreachable Pushgateway doesn't hang the command
+const metricsPushTimeout = 10 * time.Second
+
+// runMetrics records the metrics of the command being run, it is replaced at the start of each run
+var runMetrics = metrics.NewRecorder(metrics.NewRegistry())
+
+// exportMetrics records the outcome of a command and writes its metrics to the textfile directory and the
+// Pushgateway, if either is configured. Failing to export metrics is logged, but doesn't fail the command.
+func exportMetrics(ctx context.Context, command string, started time.Time, err error, fileDir string) {
+	if CLI.MetricsTextfileDir == "" && CLI.MetricsPushUrl == "" {
+		return
+	}
+
+	// Finding there is nothing to do is a successful run
+	success := err == nil || nothingToDo(err)
+	runMetrics.Finished(command, started, success)
+
+	// Every run reports the loaded cycle, even if it didn't change it
+	loadedCycle, loadErr := airac.NewLoadedAirac(fileDir)
+	if loadErr != nil {
+		log.Warn().Err(loadErr).Msg("failed to read the loaded cycle for metrics")
+	} else if state := loadedCycle.State(); state.Ident != "" {
+		runMetrics.LoadedCycle(state.Ident, state.ImportedAt)
+	}
+
+	if CLI.MetricsTextfileDir != "" {
+		if err := metrics.WriteTextfile(runMetrics.Registry(), CLI.MetricsTextfileDir, command); err != nil {
+			log.Error().Err(err).Str("dir", CLI.MetricsTextfileDir).Msg("failed to write metrics textfile")
+		}
+	}
+
+	if CLI.MetricsPushUrl != "" {
+		pushMetrics(ctx, command)
+	}
+}
+
+// pushMetrics pushes the metrics of the command to the Pushgateway
+func pushMetrics(ctx context.Context, command string) {
+	client, err := reportingHttpClient()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create the HTTP client for metrics")
+		return
+	}
+
+	// Push even if the command was cancelled, as that is worth knowing about
+	pushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), metricsPushTimeout)
+	defer cancel()
+
+	err = metrics.Push(pushCtx, client, runMetrics.Registry(), CLI.MetricsPushUrl, metrics.Labels{"command": command})
+	if err != nil {
+		log.Error().Err(err).Str("url", CLI.MetricsPushUrl).Msg("failed to push metrics")
+	}
+}
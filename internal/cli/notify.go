@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/config"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/notify"
+)
+
+// notifyTimeout is how long sending notifications may take, so that an unreachable webhook doesn't hang the command
+const notifyTimeout = 10 * time.Second
+
+// sendNotification sends the notification to the targets in the settings that want it. Failing to send it is
+// logged, but doesn't fail the command.
+func sendNotification(ctx context.Context, notification notify.Notification) {
+	cfg, err := settings()
+	if err != nil {
+		return
+	}
+
+	targets, err := notifyTargets(cfg.Notify)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read notification settings")
+		return
+	}
+
+	if len(targets) == 0 {
+		return
+	}
+
+	client, err := reportingHttpClient()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create the HTTP client for notifications")
+		return
+	}
+
+	// Send even if the command was cancelled, as that is worth knowing about
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	defer cancel()
+
+	err = notify.NewNotifier(client, targets...).Notify(sendCtx, notification)
+	if err != nil {
+		log.Error().Err(err).Str("event", string(notification.Event)).Msg("failed to send notification")
+		return
+	}
+
+	log.Debug().Str("event", string(notification.Event)).Msgf("sent %v notification", notification.Event)
+}
+
+// notifyTargets returns where notifications are sent
+func notifyTargets(notifyConfig config.NotifyConfig) ([]notify.Target, error) {
+	targets := make([]notify.Target, 0)
+	for _, target := range []struct {
+		format notify.Format
+		url    string
+		events string
+	}{
+		{notify.FormatWebhook, notifyConfig.WebhookUrl, notifyConfig.WebhookEvents},
+		{notify.FormatDiscord, notifyConfig.DiscordUrl, notifyConfig.DiscordEvents},
+	} {
+		if target.url == "" {
+			continue
+		}
+
+		events, err := notify.ParseEvents(target.events)
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, notify.Target{Format: target.format, Url: target.url, Events: events})
+	}
+
+	return targets, nil
+}
+
+// importNotification describes the outcome of an import, a changeover if it changed the loaded cycle
+func importNotification(cycle string, previous airac.LoadedState, loaded airac.LoadedState, err error, now time.Time) notify.Notification {
+	if err != nil {
+		return notify.Notification{Event: notify.EventFailure, Stage: notify.StageImport, Cycle: cycle, Error: err.Error(), Time: now}
+	}
+
+	event := notify.EventSuccess
+	if loaded.Ident != previous.Ident {
+		event = notify.EventChangeover
+	}
+
+	return notify.Notification{
+		Event:          event,
+		Stage:          notify.StageImport,
+		Cycle:          loaded.Ident,
+		PreviousCycle:  previous.Ident,
+		Routes:         loaded.RouteCount,
+		RouteErrors:    loaded.RouteErrorCount,
+		Notes:          loaded.NoteCount,
+		NoteErrors:     loaded.NoteErrorCount,
+		PreviousRoutes: previous.RouteCount,
+		PreviousNotes:  previous.NoteCount,
+		Time:           now,
+	}
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/tracing"
+)
+
+// tracingShutdownTimeout is how long sending the last spans may take when the command finishes
+const tracingShutdownTimeout = 10 * time.Second
+
+// configureTracing sends spans to the OTLP endpoint if one is given, returning a function that sends any spans
+// that are left once the command has finished
+func configureTracing(ctx context.Context) (func(), error) {
+	if CLI.TraceEndpoint == "" {
+		return func() {}, nil
+	}
+
+	shutdown, err := tracing.Setup(ctx, CLI.TraceEndpoint)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to configure tracing")
+		return nil, err
+	}
+
+	log.Debug().Msgf("Sending traces to %v", CLI.TraceEndpoint)
+	return func() {
+		// Send the spans even if the command was cancelled, as they show where it got to
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tracingShutdownTimeout)
+		defer cancel()
+
+		if err := shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("failed to send traces")
+		}
+	}, nil
+}
@@ -0,0 +1,405 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileName is the name of the config file in the XDG config directory
+const fileName = "config.yaml"
+
+// redacted replaces secrets when a config is shown
+const redacted = "<redacted>"
+
+var (
+	ErrUnknownProfile   = errors.New("unknown config profile")
+	ErrInvalidConfig    = errors.New("invalid config file")
+	ErrInvalidEnv       = errors.New("invalid environment variable")
+	ErrCannotReadSecret = errors.New("failed to read secret file")
+)
+
+// Config is everything that can be set in a config file, or a profile within it
+type Config struct {
+	DataDir  string         `yaml:"data_dir,omitempty"`
+	Database DatabaseConfig `yaml:"database,omitempty"`
+	Download DownloadConfig `yaml:"download,omitempty"`
+	Import   ImportConfig   `yaml:"import,omitempty"`
+	Notify   NotifyConfig   `yaml:"notify,omitempty"`
+}
+
+type DatabaseConfig struct {
+	Host     string `yaml:"host,omitempty"`
+	Port     string `yaml:"port,omitempty"`
+	Socket   string `yaml:"socket,omitempty"`
+	Database string `yaml:"database,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+
+	// A file containing the password, such as a container secret, used if the password isn't set
+	PasswordFile string `yaml:"password_file,omitempty"`
+
+	// A complete DSN, or a file containing one, used instead of the connection settings above and TLS
+	Dsn     string `yaml:"dsn,omitempty"`
+	DsnFile string `yaml:"dsn_file,omitempty"`
+
+	Tls          TlsConfig     `yaml:"tls,omitempty"`
+	Charset      string        `yaml:"charset,omitempty"`
+	Timeout      time.Duration `yaml:"timeout,omitempty"`
+	ReadTimeout  time.Duration `yaml:"read_timeout,omitempty"`
+	WriteTimeout time.Duration `yaml:"write_timeout,omitempty"`
+}
+
+// Configured reports whether any of the settings to connect to the database have been given
+func (d DatabaseConfig) Configured() bool {
+	return d.Host != "" || d.Port != "" || d.Socket != "" || d.Database != "" || d.Username != "" ||
+		d.Password != "" || d.PasswordFile != "" || d.Dsn != "" || d.DsnFile != ""
+}
+
+// TlsConfig configures TLS for the database connection, see db.TlsParams
+type TlsConfig struct {
+	Mode       string `yaml:"mode,omitempty"`
+	CaFile     string `yaml:"ca_file,omitempty"`
+	CertFile   string `yaml:"cert_file,omitempty"`
+	KeyFile    string `yaml:"key_file,omitempty"`
+	ServerName string `yaml:"server_name,omitempty"`
+}
+
+type DownloadConfig struct {
+	// How to work out the download URL, see download.UrlOptions
+	UrlTemplate string `yaml:"url_template,omitempty"`
+	Discover    bool   `yaml:"discover,omitempty"`
+	IndexUrl    string `yaml:"index_url,omitempty"`
+
+	// The HTTP client used for downloads, see download.ClientOptions
+	ProxyUrl       string `yaml:"proxy_url,omitempty"`
+	CaFile         string `yaml:"ca_file,omitempty"`
+	ClientCertFile string `yaml:"client_cert_file,omitempty"`
+	ClientKeyFile  string `yaml:"client_key_file,omitempty"`
+	UserAgent      string `yaml:"user_agent,omitempty"`
+	Headers        string `yaml:"headers,omitempty"`
+}
+
+// ImportConfig tunes imports, the waits are pointers so that a wait of 0 can be told apart from one that isn't set
+type ImportConfig struct {
+	// How many rows are inserted at a time, and how long to wait between batches
+	BatchSize int            `yaml:"batch_size,omitempty"`
+	BatchWait *time.Duration `yaml:"batch_wait,omitempty"`
+
+	// How many times the import is run before giving up on transient database errors, and the wait before the
+	// first retry, see db.RetryPolicy
+	Attempts     int            `yaml:"attempts,omitempty"`
+	RetryBackoff *time.Duration `yaml:"retry_backoff,omitempty"`
+
+	Thresholds ThresholdsConfig `yaml:"thresholds,omitempty"`
+}
+
+// ThresholdsConfig are the limits an import must be within to be committed, see srd.Thresholds. Percentages that
+// aren't set use the defaults, they are pointers so that a percentage of 0 can be told apart from one that isn't set.
+type ThresholdsConfig struct {
+	MaxRouteErrorPercent *float64 `yaml:"max_route_error_percent,omitempty"`
+	MaxNoteErrorPercent  *float64 `yaml:"max_note_error_percent,omitempty"`
+	MaxRouteDropPercent  *float64 `yaml:"max_route_drop_percent,omitempty"`
+	MaxNoteDropPercent   *float64 `yaml:"max_note_drop_percent,omitempty"`
+	MinRoutes            int      `yaml:"min_routes,omitempty"`
+	MinNotes             int      `yaml:"min_notes,omitempty"`
+}
+
+// NotifyConfig is where notifications of downloads and imports are sent, see notify.Target. The events are a
+// comma separated list of success, failure and changeover, all of them if empty.
+type NotifyConfig struct {
+	WebhookUrl    string `yaml:"webhook_url,omitempty"`
+	WebhookEvents string `yaml:"webhook_events,omitempty"`
+	DiscordUrl    string `yaml:"discord_url,omitempty"`
+	DiscordEvents string `yaml:"discord_events,omitempty"`
+}
+
+// file is the layout of a config file, the top level settings apply to every profile
+type file struct {
+	Config `yaml:",inline"`
+
+	// The profile used when none is chosen on the command line
+	Profile string `yaml:"profile"`
+
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// DefaultPath returns where the config file is looked for when one isn't given, following the XDG base directory
+// specification
+func DefaultPath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+
+		configHome = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(configHome, "ukcp-srd-tools", fileName)
+}
+
+// Load reads a config file, applying the settings of the named profile over the top level ones. If no profile is
+// named, the file's default profile is used, if it has one. The name of the profile used is returned.
+func Load(path string, profile string) (Config, string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, "", err
+	}
+
+	var f file
+	err = yaml.Unmarshal(content, &f)
+	if err != nil {
+		return Config{}, "", fmt.Errorf("%w %v: %v", ErrInvalidConfig, path, err)
+	}
+
+	if profile == "" {
+		profile = f.Profile
+	}
+
+	if profile == "" {
+		return f.Config, "", nil
+	}
+
+	node, ok := f.Profiles[profile]
+	if !ok {
+		return Config{}, "", fmt.Errorf("%w %q, the profiles in %v are: %v", ErrUnknownProfile, profile, path, profileNames(f.Profiles))
+	}
+
+	// Decoding into the top level settings only replaces those the profile sets
+	config := f.Config
+	err = node.Decode(&config)
+	if err != nil {
+		return Config{}, "", fmt.Errorf("%w %v, profile %v: %v", ErrInvalidConfig, path, profile, err)
+	}
+
+	return config, profile, nil
+}
+
+// ApplyEnv returns the config with any settings that are also given as environment variables replaced
+func (c Config) ApplyEnv(lookup func(string) (string, bool)) (Config, error) {
+	settings := map[string]*string{
+		"DB_HOST":                   &c.Database.Host,
+		"DB_PORT":                   &c.Database.Port,
+		"DB_SOCKET":                 &c.Database.Socket,
+		"DB_DATABASE":               &c.Database.Database,
+		"DB_USERNAME":               &c.Database.Username,
+		"DB_PASSWORD":               &c.Database.Password,
+		"DB_PASSWORD_FILE":          &c.Database.PasswordFile,
+		"DB_DSN":                    &c.Database.Dsn,
+		"DB_DSN_FILE":               &c.Database.DsnFile,
+		"DB_CHARSET":                &c.Database.Charset,
+		"DB_TLS_MODE":               &c.Database.Tls.Mode,
+		"DB_TLS_CA_FILE":            &c.Database.Tls.CaFile,
+		"DB_TLS_CERT_FILE":          &c.Database.Tls.CertFile,
+		"DB_TLS_KEY_FILE":           &c.Database.Tls.KeyFile,
+		"DB_TLS_SERVER_NAME":        &c.Database.Tls.ServerName,
+		"DOWNLOAD_URL_TEMPLATE":     &c.Download.UrlTemplate,
+		"DOWNLOAD_INDEX_URL":        &c.Download.IndexUrl,
+		"DOWNLOAD_PROXY_URL":        &c.Download.ProxyUrl,
+		"DOWNLOAD_CA_FILE":          &c.Download.CaFile,
+		"DOWNLOAD_CLIENT_CERT_FILE": &c.Download.ClientCertFile,
+		"DOWNLOAD_CLIENT_KEY_FILE":  &c.Download.ClientKeyFile,
+		"DOWNLOAD_USER_AGENT":       &c.Download.UserAgent,
+		"DOWNLOAD_HEADERS":          &c.Download.Headers,
+		"NOTIFY_WEBHOOK_URL":        &c.Notify.WebhookUrl,
+		"NOTIFY_WEBHOOK_EVENTS":     &c.Notify.WebhookEvents,
+		"NOTIFY_DISCORD_URL":        &c.Notify.DiscordUrl,
+		"NOTIFY_DISCORD_EVENTS":     &c.Notify.DiscordEvents,
+	}
+
+	// A secret and the file holding it are one setting, so either in the environment replaces both in the profile.
+	// Otherwise a password in the profile would be used instead of a password file from the environment.
+	replacedSecrets := map[string]*string{
+		"DB_PASSWORD":      &c.Database.PasswordFile,
+		"DB_PASSWORD_FILE": &c.Database.Password,
+		"DB_DSN":           &c.Database.DsnFile,
+		"DB_DSN_FILE":      &c.Database.Dsn,
+	}
+
+	for name, setting := range replacedSecrets {
+		if value, ok := lookup(name); ok && value != "" {
+			*setting = ""
+		}
+	}
+
+	for name, setting := range settings {
+		if value, ok := lookup(name); ok && value != "" {
+			*setting = value
+		}
+	}
+
+	counts := map[string]*int{
+		"IMPORT_BATCH_SIZE": &c.Import.BatchSize,
+		"IMPORT_ATTEMPTS":   &c.Import.Attempts,
+		"IMPORT_MIN_ROUTES": &c.Import.Thresholds.MinRoutes,
+		"IMPORT_MIN_NOTES":  &c.Import.Thresholds.MinNotes,
+	}
+
+	for name, setting := range counts {
+		if value, ok := lookup(name); ok && value != "" {
+			count, err := strconv.Atoi(value)
+			if err != nil || count <= 0 {
+				return Config{}, fmt.Errorf("%w %v, must be a positive number: %q", ErrInvalidEnv, name, value)
+			}
+
+			*setting = count
+		}
+	}
+
+	percents := map[string]**float64{
+		"IMPORT_MAX_ROUTE_ERROR_PERCENT": &c.Import.Thresholds.MaxRouteErrorPercent,
+		"IMPORT_MAX_NOTE_ERROR_PERCENT":  &c.Import.Thresholds.MaxNoteErrorPercent,
+		"IMPORT_MAX_ROUTE_DROP_PERCENT":  &c.Import.Thresholds.MaxRouteDropPercent,
+		"IMPORT_MAX_NOTE_DROP_PERCENT":   &c.Import.Thresholds.MaxNoteDropPercent,
+	}
+
+	for name, setting := range percents {
+		if value, ok := lookup(name); ok && value != "" {
+			percent, err := strconv.ParseFloat(value, 64)
+			if err != nil || percent < 0 || percent > 100 {
+				return Config{}, fmt.Errorf("%w %v, must be a percentage from 0 to 100: %q", ErrInvalidEnv, name, value)
+			}
+
+			*setting = &percent
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"DB_TIMEOUT":       &c.Database.Timeout,
+		"DB_READ_TIMEOUT":  &c.Database.ReadTimeout,
+		"DB_WRITE_TIMEOUT": &c.Database.WriteTimeout,
+	}
+
+	for name, setting := range durations {
+		if value, ok := lookup(name); ok && value != "" {
+			duration, err := parseEnvDuration(name, value)
+			if err != nil {
+				return Config{}, err
+			}
+
+			*setting = duration
+		}
+	}
+
+	optionalDurations := map[string]**time.Duration{
+		"IMPORT_BATCH_WAIT":    &c.Import.BatchWait,
+		"IMPORT_RETRY_BACKOFF": &c.Import.RetryBackoff,
+	}
+
+	for name, setting := range optionalDurations {
+		if value, ok := lookup(name); ok && value != "" {
+			duration, err := parseEnvDuration(name, value)
+			if err != nil {
+				return Config{}, err
+			}
+
+			*setting = &duration
+		}
+	}
+
+	return c, nil
+}
+
+// parseEnvDuration parses a duration given as an environment variable
+func parseEnvDuration(name string, value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("%w %v, must be a duration such as 500ms: %q", ErrInvalidEnv, name, value)
+	}
+
+	return duration, nil
+}
+
+// Redacted returns the config with secrets replaced, so that it can be shown
+func (c Config) Redacted() Config {
+	if c.Database.Password != "" {
+		c.Database.Password = redacted
+	}
+
+	// A DSN includes the password
+	if c.Database.Dsn != "" {
+		c.Database.Dsn = redacted
+	}
+
+	// Headers are often used for credentials
+	if c.Download.Headers != "" {
+		c.Download.Headers = redacted
+	}
+
+	// Proxy URLs may include credentials, the rest of the URL is useful to see
+	if c.Download.ProxyUrl != "" {
+		c.Download.ProxyUrl = redactUserinfo(c.Download.ProxyUrl)
+	}
+
+	// Webhook URLs include a token that lets anyone post to them
+	if c.Notify.WebhookUrl != "" {
+		c.Notify.WebhookUrl = redacted
+	}
+
+	if c.Notify.DiscordUrl != "" {
+		c.Notify.DiscordUrl = redacted
+	}
+
+	return c
+}
+
+// redactUserinfo replaces the username and password in a URL, or the whole URL if it can't be parsed
+func redactUserinfo(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return redacted
+	}
+
+	if parsed.User == nil {
+		return rawUrl
+	}
+
+	// Setting the user to the placeholder would escape it
+	parsed.User = nil
+	return strings.Replace(parsed.String(), "//", "//"+redacted+"@", 1)
+}
+
+// Yaml returns the config in the same format as the config file
+func (c Config) Yaml() (string, error) {
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// ReadSecret returns the value if it is set, otherwise the contents of the file, without a trailing newline.
+// This lets secrets be mounted as files, as container orchestrators do, rather than kept in plain text.
+func ReadSecret(value string, file string) (string, error) {
+	if value != "" || file == "" {
+		return value, nil
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrCannotReadSecret, err)
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func profileNames(profiles map[string]yaml.Node) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
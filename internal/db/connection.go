@@ -0,0 +1,203 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TLS modes, named after the MySQL client's --ssl-mode values
+const (
+	// TlsDisabled never uses TLS, the default
+	TlsDisabled = "disabled"
+
+	// TlsPreferred uses TLS if the server supports it, without verifying the server's certificate
+	TlsPreferred = "preferred"
+
+	// TlsRequired requires TLS, without verifying the server's certificate
+	TlsRequired = "required"
+
+	// TlsVerifyCa requires TLS with a certificate signed by a trusted CA, without checking the host name
+	TlsVerifyCa = "verify-ca"
+
+	// TlsVerifyIdentity requires TLS with a certificate signed by a trusted CA for the host being connected to
+	TlsVerifyIdentity = "verify-identity"
+)
+
+var (
+	ErrInvalidTlsMode = errors.New("invalid database TLS mode, must be disabled, preferred, required, verify-ca or verify-identity")
+	ErrInvalidDsn     = errors.New("invalid database DSN")
+	ErrInvalidTls     = errors.New("invalid database TLS configuration")
+)
+
+// TlsParams configures TLS for the database connection
+type TlsParams struct {
+	Mode string
+
+	// CaFile is a PEM bundle of CAs trusted to sign the server's certificate, in addition to the system roots
+	CaFile string
+
+	// CertFile and KeyFile are a PEM certificate and key presented to the server
+	CertFile string
+	KeyFile  string
+
+	// ServerName is the name expected in the server's certificate, defaulting to the host
+	ServerName string
+}
+
+// DsnDatabase returns the name of the database in a DSN
+func DsnDatabase(dsn string) (string, error) {
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDsn, err)
+	}
+
+	return config.DBName, nil
+}
+
+// mysqlConfig returns the driver configuration for the connection parameters
+func (p DatabaseConnectionParams) mysqlConfig() (*mysql.Config, error) {
+	var config *mysql.Config
+	if p.Dsn != "" {
+		parsed, err := mysql.ParseDSN(p.Dsn)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDsn, err)
+		}
+
+		config = parsed
+	} else {
+		config = mysql.NewConfig()
+		config.User = p.Username
+		config.Passwd = p.Password
+		config.DBName = p.Database
+
+		if p.Socket != "" {
+			config.Net = "unix"
+			config.Addr = p.Socket
+		} else {
+			config.Net = "tcp"
+			config.Addr = net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+		}
+
+		if p.Charset != "" {
+			config.Params = map[string]string{"charset": p.Charset}
+		}
+
+		err := p.Tls.apply(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Timeouts apply to a DSN too, unless it sets its own
+	if p.Timeout > 0 && config.Timeout == 0 {
+		config.Timeout = p.Timeout
+	}
+
+	if p.ReadTimeout > 0 && config.ReadTimeout == 0 {
+		config.ReadTimeout = p.ReadTimeout
+	}
+
+	if p.WriteTimeout > 0 && config.WriteTimeout == 0 {
+		config.WriteTimeout = p.WriteTimeout
+	}
+
+	// Parse times so that the srd_meta import time can be scanned
+	config.ParseTime = true
+
+	return config, nil
+}
+
+// apply sets up TLS on the driver configuration
+func (t TlsParams) apply(config *mysql.Config) error {
+	switch t.Mode {
+	case "", TlsDisabled:
+		if t.CaFile != "" || t.CertFile != "" {
+			return fmt.Errorf("%w: certificates are given but TLS is disabled", ErrInvalidTls)
+		}
+
+		return nil
+	case TlsPreferred, TlsRequired, TlsVerifyCa, TlsVerifyIdentity:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidTlsMode, t.Mode)
+	}
+
+	tlsConfig := &tls.Config{ServerName: t.ServerName}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return fmt.Errorf("%w: failed to load client certificate: %v", ErrInvalidTls, err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	var roots *x509.CertPool
+	if t.CaFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(t.CaFile)
+		if err != nil {
+			return fmt.Errorf("%w: failed to read CA file: %v", ErrInvalidTls, err)
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%w: no certificates found in CA file %v", ErrInvalidTls, t.CaFile)
+		}
+
+		roots = pool
+	}
+
+	switch t.Mode {
+	case TlsPreferred:
+		tlsConfig.InsecureSkipVerify = true
+		config.AllowFallbackToPlaintext = true
+	case TlsRequired:
+		tlsConfig.InsecureSkipVerify = true
+	case TlsVerifyCa:
+		// Go's TLS can't check the chain without the host name, so skip its checks and check the chain ourselves
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = verifyChain(roots)
+	case TlsVerifyIdentity:
+		tlsConfig.RootCAs = roots
+	}
+
+	config.TLS = tlsConfig
+	return nil
+}
+
+// verifyChain returns a function that checks the server's certificate was signed by a trusted CA
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server did not present a certificate")
+		}
+
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+
+			certs = append(certs, cert)
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		return err
+	}
+}
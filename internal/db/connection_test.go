@@ -0,0 +1,224 @@
+package db
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate is a certificate and its key, written to files
+type testCertificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certPath string
+	keyPath  string
+}
+
+// writeCertificate generates a certificate for the name, signed by the parent or self-signed if there isn't one
+func writeCertificate(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	certDer, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(certDer)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certPath := dir + "/cert.pem"
+	keyPath := dir + "/key.pem"
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	return &testCertificate{cert: cert, key: key, certPath: certPath, keyPath: keyPath}
+}
+
+func TestMysqlConfig_Tcp(t *testing.T) {
+	require := require.New(t)
+
+	config, err := DatabaseConnectionParams{
+		Host:         "db.example.com",
+		Port:         3307,
+		Username:     "user",
+		Password:     "pass",
+		Database:     "uk_plugin",
+		Charset:      "utf8mb4",
+		Timeout:      5 * time.Second,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}.mysqlConfig()
+	require.NoError(err)
+
+	require.Equal("tcp", config.Net)
+	require.Equal("db.example.com:3307", config.Addr)
+	require.Equal("user", config.User)
+	require.Equal("pass", config.Passwd)
+	require.Equal("uk_plugin", config.DBName)
+	require.Equal(map[string]string{"charset": "utf8mb4"}, config.Params)
+	require.Equal(5*time.Second, config.Timeout)
+	require.Equal(30*time.Second, config.ReadTimeout)
+	require.Equal(10*time.Second, config.WriteTimeout)
+	require.True(config.ParseTime)
+	require.Nil(config.TLS)
+}
+
+func TestMysqlConfig_Socket(t *testing.T) {
+	require := require.New(t)
+
+	config, err := DatabaseConnectionParams{
+		Socket:   "/var/run/mysqld/mysqld.sock",
+		Username: "user",
+		Database: "uk_plugin",
+	}.mysqlConfig()
+	require.NoError(err)
+
+	require.Equal("unix", config.Net)
+	require.Equal("/var/run/mysqld/mysqld.sock", config.Addr)
+}
+
+func TestMysqlConfig_Dsn(t *testing.T) {
+	require := require.New(t)
+
+	config, err := DatabaseConnectionParams{
+		Dsn:         "dsnuser:dsnpass@tcp(dsn.example.com:3306)/dsn_db?readTimeout=1s",
+		Host:        "ignored.example.com",
+		Timeout:     5 * time.Second,
+		ReadTimeout: 30 * time.Second,
+	}.mysqlConfig()
+	require.NoError(err)
+
+	require.Equal("dsn.example.com:3306", config.Addr)
+	require.Equal("dsnuser", config.User)
+	require.Equal("dsn_db", config.DBName)
+
+	// Times are always parsed, and timeouts only fill in those the DSN doesn't set
+	require.True(config.ParseTime)
+	require.Equal(5*time.Second, config.Timeout)
+	require.Equal(time.Second, config.ReadTimeout)
+
+	_, err = DatabaseConnectionParams{Dsn: "not a dsn"}.mysqlConfig()
+	require.ErrorIs(err, ErrInvalidDsn)
+}
+
+func TestDsnDatabase(t *testing.T) {
+	database, err := DsnDatabase("user:pass@unix(/tmp/mysql.sock)/uk_plugin")
+	require.NoError(t, err)
+	require.Equal(t, "uk_plugin", database)
+
+	_, err = DsnDatabase("not a dsn")
+	require.ErrorIs(t, err, ErrInvalidDsn)
+}
+
+func TestMysqlConfig_Tls(t *testing.T) {
+	ca := writeCertificate(t, "Test CA", nil)
+	client := writeCertificate(t, "client", ca)
+
+	base := DatabaseConnectionParams{Host: "db.example.com", Port: 3306, Username: "user", Password: "pass", Database: "uk_plugin"}
+
+	t.Run("preferred", func(t *testing.T) {
+		params := base
+		params.Tls = TlsParams{Mode: TlsPreferred}
+
+		config, err := params.mysqlConfig()
+		require.NoError(t, err)
+		require.True(t, config.TLS.InsecureSkipVerify)
+		require.True(t, config.AllowFallbackToPlaintext)
+	})
+
+	t.Run("required", func(t *testing.T) {
+		params := base
+		params.Tls = TlsParams{Mode: TlsRequired}
+
+		config, err := params.mysqlConfig()
+		require.NoError(t, err)
+		require.True(t, config.TLS.InsecureSkipVerify)
+		require.False(t, config.AllowFallbackToPlaintext)
+	})
+
+	t.Run("verify ca", func(t *testing.T) {
+		params := base
+		params.Tls = TlsParams{Mode: TlsVerifyCa, CaFile: ca.certPath}
+
+		config, err := params.mysqlConfig()
+		require.NoError(t, err)
+		require.True(t, config.TLS.InsecureSkipVerify)
+
+		// Any name is accepted from a certificate signed by the CA, but not one that isn't
+		server := writeCertificate(t, "another-name.example.com", ca)
+		require.NoError(t, config.TLS.VerifyPeerCertificate([][]byte{server.cert.Raw}, nil))
+
+		untrusted := writeCertificate(t, "db.example.com", nil)
+		require.Error(t, config.TLS.VerifyPeerCertificate([][]byte{untrusted.cert.Raw}, nil))
+	})
+
+	t.Run("verify identity with client certificate", func(t *testing.T) {
+		params := base
+		params.Tls = TlsParams{
+			Mode:       TlsVerifyIdentity,
+			CaFile:     ca.certPath,
+			CertFile:   client.certPath,
+			KeyFile:    client.keyPath,
+			ServerName: "mysql.internal",
+		}
+
+		config, err := params.mysqlConfig()
+		require.NoError(t, err)
+		require.False(t, config.TLS.InsecureSkipVerify)
+		require.NotNil(t, config.TLS.RootCAs)
+		require.Equal(t, "mysql.internal", config.TLS.ServerName)
+		require.Len(t, config.TLS.Certificates, 1)
+	})
+
+	tests := []struct {
+		name        string
+		tls         TlsParams
+		expectedErr error
+	}{
+		{"invalid mode", TlsParams{Mode: "sometimes"}, ErrInvalidTlsMode},
+		{"certificates without tls", TlsParams{CaFile: ca.certPath}, ErrInvalidTls},
+		{"missing ca file", TlsParams{Mode: TlsVerifyCa, CaFile: "/nonexistent/ca.pem"}, ErrInvalidTls},
+		{"ca file without certificates", TlsParams{Mode: TlsVerifyCa, CaFile: client.keyPath}, ErrInvalidTls},
+		{"missing client key", TlsParams{Mode: TlsRequired, CertFile: client.certPath}, ErrInvalidTls},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := base
+			params.Tls = tt.tls
+
+			_, err := params.mysqlConfig()
+			require.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
@@ -1,12 +1,14 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/rs/zerolog/log"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/tracing"
 )
 
 type Database struct {
@@ -19,19 +21,53 @@ type DatabaseConnectionParams struct {
 	Username string
 	Password string
 	Database string
+
+	// Socket is the path of a unix socket to connect through, instead of the host and port
+	Socket string
+
+	// Dsn is a complete go-sql-driver/mysql DSN, used instead of all of the fields above and TLS.
+	// Database must still be set, to the DSN's database (see DsnDatabase), as it names the import lock.
+	Dsn string
+
+	Tls TlsParams
+
+	// Charset is the connection character set, the server default if empty
+	Charset string
+
+	// Timeouts for establishing the connection, and for each read and write, none if zero
+	Timeout      time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
 }
 
 // NewDatabase creates a new MySQL database connection
 func NewDatabase(params DatabaseConnectionParams) (*Database, error) {
-	// Connect to the database
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", params.Username, params.Password, params.Host, params.Port, params.Database))
+	db, err := open(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Database{db: db}, nil
+}
+
+// open connects to the database and checks the connection works
+func open(params DatabaseConnectionParams) (*sql.DB, error) {
+	config, err := params.mysqlConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := mysql.NewConnector(config)
 	if err != nil {
 		return nil, err
 	}
 
+	db := sql.OpenDB(connector)
+
 	// Check the connection
 	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
@@ -39,7 +75,7 @@ func NewDatabase(params DatabaseConnectionParams) (*Database, error) {
 	db.SetMaxOpenConns(1)
 	db.SetConnMaxLifetime(2 * time.Minute)
 
-	return &Database{db: db}, nil
+	return db, nil
 }
 
 // Close closes the database connection
@@ -47,7 +83,9 @@ func (d *Database) Close() error {
 	return d.db.Close()
 }
 
-func (d *Database) Transaction(f func(tx *Transaction) error) error {
+// Transaction runs f in a transaction, committing it if f succeeds and rolling it back otherwise.
+// If the context is cancelled by the time f returns, the transaction is rolled back rather than committed.
+func (d *Database) Transaction(ctx context.Context, f func(tx *Transaction) error) error {
 	tx, err := d.db.Begin()
 	if err != nil {
 		return err
@@ -55,16 +93,26 @@ func (d *Database) Transaction(f func(tx *Transaction) error) error {
 
 	transactionWrapper := &Transaction{tx: tx}
 	err = f(transactionWrapper)
+	if err == nil {
+		err = ctx.Err()
+	}
+
 	if err != nil {
 		dbErr := tx.Rollback()
 		if dbErr != nil {
 			log.Error().Err(dbErr).Msg("failed to rollback transaction")
+		} else {
+			log.Debug().Msg("rolled back transaction")
 		}
 
 		return err
 	}
 
-	return tx.Commit()
+	_, span := tracing.Start(ctx, "db.commit")
+	err = tx.Commit()
+	tracing.End(span, err)
+
+	return err
 }
 
 func (d *Database) Handle() *sql.DB {
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// maxLockNameLength is the longest name MySQL allows for a lock
+const maxLockNameLength = 64
+
+var (
+	ErrDatabaseLocked = errors.New("another process is importing into the database")
+	ErrLockFailed     = errors.New("failed to acquire database lock")
+)
+
+// LockHolder describes the database connection that holds a lock
+type LockHolder struct {
+	ConnectionId int64
+
+	// User and Host are the account and client address of the connection, empty if we aren't allowed to see them
+	User string
+	Host string
+
+	// How long the connection has been in its current state. Locks taken by this tool have a connection that
+	// does nothing else once the lock is taken, so this is how long the lock has been held.
+	Duration time.Duration
+}
+
+func (h *LockHolder) String() string {
+	if h.Host == "" {
+		return fmt.Sprintf("connection %d", h.ConnectionId)
+	}
+
+	return fmt.Sprintf("connection %d (%s@%s, held for %v)", h.ConnectionId, h.User, h.Host, h.Duration)
+}
+
+// LockedError is returned when a lock is held by another connection
+type LockedError struct {
+	Name   string
+	Holder *LockHolder
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%v: lock %v is held", ErrDatabaseLocked, e.Name)
+	}
+
+	return fmt.Sprintf("%v: lock %v is held by %v", ErrDatabaseLocked, e.Name, e.Holder)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrDatabaseLocked
+}
+
+// AdvisoryLock is a MySQL named lock (GET_LOCK), which is held by the connection that took it, so each lock has a
+// connection of its own that it keeps for as long as the lock is held
+type AdvisoryLock struct {
+	db   *sql.DB
+	conn *sql.Conn
+	name string
+}
+
+// ImportLockName returns the name of the lock taken while importing into a database. Lock names are server wide,
+// so the name includes the database to let imports into different databases on the same server run together.
+func ImportLockName(database string) string {
+	name := "ukcp-srd-tools:import:" + database
+	if len(name) > maxLockNameLength {
+		name = name[:maxLockNameLength]
+	}
+
+	return name
+}
+
+// NewAdvisoryLock takes the named lock, waiting up to the timeout for another connection to release it.
+// If the lock is still held after the timeout, a LockedError describing the holder is returned.
+func NewAdvisoryLock(ctx context.Context, params DatabaseConnectionParams, name string, timeout time.Duration) (*AdvisoryLock, error) {
+	db, err := open(params)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	lock := &AdvisoryLock{db: db, conn: conn, name: name}
+
+	// GET_LOCK waits in whole seconds, returning 1 if the lock was taken, 0 on timeout and NULL on error
+	var acquired sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(math.Ceil(timeout.Seconds()))).Scan(&acquired)
+	if err == nil && !acquired.Valid {
+		err = errors.New("GET_LOCK returned NULL")
+	}
+
+	if err != nil {
+		lock.close()
+		return nil, fmt.Errorf("%w: %v", ErrLockFailed, err)
+	}
+
+	if acquired.Int64 != 1 {
+		holder := lock.holder(ctx)
+		lock.close()
+		return nil, &LockedError{Name: name, Holder: holder}
+	}
+
+	return lock, nil
+}
+
+// Name returns the name of the lock
+func (l *AdvisoryLock) Name() string {
+	return l.name
+}
+
+// Release releases the lock and closes its connection
+func (l *AdvisoryLock) Release() error {
+	_, err := l.conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", l.name)
+	closeErr := l.close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+// holder looks up who holds the lock, returning nil if nobody does or it can't be found
+func (l *AdvisoryLock) holder(ctx context.Context) *LockHolder {
+	var connectionId sql.NullInt64
+	err := l.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?)", l.name).Scan(&connectionId)
+	if err != nil || !connectionId.Valid {
+		return nil
+	}
+
+	holder := &LockHolder{ConnectionId: connectionId.Int64}
+
+	// The process list only shows other accounts' connections with the PROCESS privilege, so this is best effort
+	var seconds int64
+	err = l.conn.QueryRowContext(
+		ctx,
+		"SELECT USER, HOST, TIME FROM information_schema.PROCESSLIST WHERE ID = ?",
+		connectionId.Int64,
+	).Scan(&holder.User, &holder.Host, &seconds)
+	if err == nil {
+		holder.Duration = time.Duration(seconds) * time.Second
+	}
+
+	return holder
+}
+
+func (l *AdvisoryLock) close() error {
+	connErr := l.conn.Close()
+	dbErr := l.db.Close()
+	if connErr != nil {
+		return connErr
+	}
+
+	return dbErr
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportLockName(t *testing.T) {
+	require.Equal(t, "ukcp-srd-tools:import:uk_plugin", ImportLockName("uk_plugin"))
+
+	// MySQL limits lock names to 64 characters
+	name := ImportLockName(strings.Repeat("a", 100))
+	require.Len(t, name, maxLockNameLength)
+	require.True(t, strings.HasPrefix(name, "ukcp-srd-tools:import:aaa"))
+}
+
+func TestLockedError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      *LockedError
+		expected string
+	}{
+		{
+			name:     "unknown holder",
+			err:      &LockedError{Name: "lock"},
+			expected: "another process is importing into the database: lock lock is held",
+		},
+		{
+			name:     "holder without process list access",
+			err:      &LockedError{Name: "lock", Holder: &LockHolder{ConnectionId: 12}},
+			expected: "another process is importing into the database: lock lock is held by connection 12",
+		},
+		{
+			name: "holder with process list access",
+			err: &LockedError{
+				Name:   "lock",
+				Holder: &LockHolder{ConnectionId: 12, User: "uk_plugin", Host: "10.0.0.5:51234", Duration: 90 * time.Second},
+			},
+			expected: "another process is importing into the database: lock lock is held by connection 12 (uk_plugin@10.0.0.5:51234, held for 1m30s)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.EqualError(t, tt.err, tt.expected)
+			require.ErrorIs(t, tt.err, ErrDatabaseLocked)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+)
+
+// mysqlErrNoSuchTable is the MySQL error number for a table that doesn't exist
+const mysqlErrNoSuchTable = 1146
+
+// metaRowId is the id of the single row in srd_meta
+const metaRowId = 1
+
+// createMetaTable creates the srd_meta table, which records the SRD that is loaded into the other tables
+const createMetaTable = "CREATE TABLE IF NOT EXISTS `srd_meta` (" +
+	"`id` tinyint unsigned NOT NULL, " +
+	"`ident` varchar(8) NOT NULL, " +
+	"`imported_at` datetime NOT NULL, " +
+	"`source_file` varchar(1024) NOT NULL DEFAULT '', " +
+	"`source_checksum` char(64) NOT NULL DEFAULT '', " +
+	"`source_url` varchar(2048) NOT NULL DEFAULT '', " +
+	"`route_count` int unsigned NOT NULL DEFAULT 0, " +
+	"`route_error_count` int unsigned NOT NULL DEFAULT 0, " +
+	"`note_count` int unsigned NOT NULL DEFAULT 0, " +
+	"`note_error_count` int unsigned NOT NULL DEFAULT 0, " +
+	"`tool_version` varchar(64) NOT NULL DEFAULT '', " +
+	"PRIMARY KEY (`id`)" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci"
+
+// EnsureMetaTable creates the srd_meta table if it doesn't already exist.
+// MySQL implicitly commits on DDL statements, so this must not be called inside a transaction.
+func (d *Database) EnsureMetaTable(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, createMetaTable)
+	return err
+}
+
+// LoadedState returns the loaded cycle recorded in the srd_meta table, and false if nothing has been recorded
+func (d *Database) LoadedState(ctx context.Context) (airac.LoadedState, bool, error) {
+	state := airac.LoadedState{}
+	err := d.db.QueryRowContext(
+		ctx,
+		"SELECT ident, imported_at, source_file, source_checksum, source_url, route_count, route_error_count, note_count, note_error_count, tool_version FROM srd_meta WHERE id = ?",
+		metaRowId,
+	).Scan(
+		&state.Ident,
+		&state.ImportedAt,
+		&state.SourceFile,
+		&state.SourceChecksum,
+		&state.SourceUrl,
+		&state.RouteCount,
+		&state.RouteErrorCount,
+		&state.NoteCount,
+		&state.NoteErrorCount,
+		&state.ToolVersion,
+	)
+
+	// Databases that have never been imported into by this version won't have the table
+	var mysqlErr *mysql.MySQLError
+	if errors.Is(err, sql.ErrNoRows) || (errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrNoSuchTable) {
+		return airac.LoadedState{}, false, nil
+	}
+
+	if err != nil {
+		return airac.LoadedState{}, false, err
+	}
+
+	state.ImportedAt = state.ImportedAt.UTC()
+	return state, true, nil
+}
+
+// SetLoadedState records the loaded cycle in the srd_meta table, replacing what was there before
+func (t *Transaction) SetLoadedState(ctx context.Context, state airac.LoadedState) error {
+	_, err := t.tx.ExecContext(
+		ctx,
+		"REPLACE INTO srd_meta (id, ident, imported_at, source_file, source_checksum, source_url, route_count, route_error_count, note_count, note_error_count, tool_version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		metaRowId,
+		state.Ident,
+		state.ImportedAt.UTC(),
+		state.SourceFile,
+		state.SourceChecksum,
+		state.SourceUrl,
+		state.RouteCount,
+		state.RouteErrorCount,
+		state.NoteCount,
+		state.NoteErrorCount,
+		state.ToolVersion,
+	)
+
+	return err
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/rs/zerolog/log"
+)
+
+// MySQL server error numbers that mean the transaction was rolled back but could succeed if run again
+const (
+	errLockWaitTimeout = 1205
+	errLockDeadlock    = 1213
+)
+
+const (
+	// DefaultRetryAttempts is how many times a transaction is run before giving up on transient errors
+	DefaultRetryAttempts = 3
+
+	// DefaultRetryBackoff is how long to wait before the first retry, doubling for each retry after that
+	DefaultRetryBackoff = 5 * time.Second
+
+	// MaxRetryBackoff is the longest wait between retries
+	MaxRetryBackoff = 1 * time.Minute
+)
+
+// RetryPolicy controls how work that fails with a transient error is retried
+type RetryPolicy struct {
+	// Attempts is how many times the work is run in total, 1 means it isn't retried
+	Attempts int
+
+	// Backoff is the wait before the first retry, doubling each time up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Attempts: DefaultRetryAttempts, Backoff: DefaultRetryBackoff, MaxBackoff: MaxRetryBackoff}
+}
+
+// IsTransient reports whether an error is one that may not happen again if the work is retried: a deadlock, a lock
+// wait timeout, a network timeout or a connection that was lost part way through. Errors in the data or the SQL,
+// cancellation, and failures to connect at all, such as an unknown host or a refused connection, are not transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == errLockWaitTimeout || mysqlErr.Number == errLockDeadlock
+	}
+
+	// The driver reports a connection lost part way through a query as an invalid connection, its form of ErrBadConn
+	if errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Retry runs f until it succeeds, fails with an error that isn't transient, or has been run as many times as the
+// policy allows. The wait between attempts is cut short if the context is cancelled, returning its error.
+func Retry(ctx context.Context, policy RetryPolicy, f func() error) error {
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= policy.Attempts || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		log.Warn().Err(err).Int("attempt", attempt).Int("attempts", policy.Attempts).Dur("backoff", backoff).Msgf("transient database error on attempt %v of %v, retrying in %v", attempt, policy.Attempts, backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"no error", nil, false},
+		{"deadlock", &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}, true},
+		{"lock wait timeout", &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, true},
+		{"wrapped deadlock", fmt.Errorf("failed to insert routes: %w", &mysql.MySQLError{Number: 1213}), true},
+		{"duplicate key", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, false},
+		{"invalid connection", mysql.ErrInvalidConn, true},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, true},
+		{"broken pipe", fmt.Errorf("write: %w", syscall.EPIPE), true},
+		{"network timeout", &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, false},
+		{"unknown host", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "db.invalid", IsNotFound: true}}, false},
+		{"cancelled", context.Canceled, false},
+		{"other error", errors.New("something else"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, IsTransient(tt.err))
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	deadlock := &mysql.MySQLError{Number: 1213}
+
+	t.Run("succeeds after transient errors", func(t *testing.T) {
+		attempts := 0
+		err := Retry(context.Background(), policy, func() error {
+			attempts++
+			if attempts < 3 {
+				return deadlock
+			}
+
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, attempts)
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		attempts := 0
+		err := Retry(context.Background(), policy, func() error {
+			attempts++
+			return deadlock
+		})
+		require.ErrorIs(t, err, deadlock)
+		require.Equal(t, 3, attempts)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		attempts := 0
+		invalid := errors.New("invalid data")
+		err := Retry(context.Background(), policy, func() error {
+			attempts++
+			return invalid
+		})
+		require.ErrorIs(t, err, invalid)
+		require.Equal(t, 1, attempts)
+	})
+
+	t.Run("stops waiting when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		attempts := 0
+		err := Retry(ctx, RetryPolicy{Attempts: 3, Backoff: time.Hour}, func() error {
+			attempts++
+			return deadlock
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 1, attempts)
+	})
+}
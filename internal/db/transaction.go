@@ -31,6 +31,22 @@ func (t *Transaction) DeleteAllNotes(ctx context.Context) error {
 	return err
 }
 
+// CountRoutes returns the number of routes in the database
+func (t *Transaction) CountRoutes(ctx context.Context) (int64, error) {
+	return t.count(ctx, "SELECT COUNT(*) FROM srd_routes")
+}
+
+// CountNotes returns the number of notes in the database
+func (t *Transaction) CountNotes(ctx context.Context) (int64, error) {
+	return t.count(ctx, "SELECT COUNT(*) FROM srd_notes")
+}
+
+func (t *Transaction) count(ctx context.Context, query string) (int64, error) {
+	var count int64
+	err := t.tx.QueryRowContext(ctx, query).Scan(&count)
+	return count, err
+}
+
 // InsertNoteBatch inserts a batch of notes into the database
 func (t *Transaction) InsertNoteBatch(ctx context.Context, notes []*note.Note) error {
 	queryString := "INSERT INTO srd_notes (id, note_text) VALUES "
@@ -0,0 +1,182 @@
+package download
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultUserAgent is sent with download requests when no other user agent is configured
+const DefaultUserAgent = "ukcp-srd-tools"
+
+var (
+	ErrInvalidProxyUrl     = errors.New("invalid download proxy URL")
+	ErrInvalidCaFile       = errors.New("invalid download CA certificate file")
+	ErrInvalidClientCert   = errors.New("invalid download client certificate")
+	ErrIncompleteClientKey = errors.New("download client certificate and key must be provided together")
+	ErrInvalidHeader       = errors.New("invalid download header, must be in the form 'Name: value'")
+)
+
+// ClientOptions configures the HTTP client used to download the SRD
+type ClientOptions struct {
+	// ProxyUrl is the proxy to send requests through, if empty the standard proxy environment variables are used
+	ProxyUrl string
+
+	// CaFile is a PEM bundle of certificates trusted in addition to the system roots
+	CaFile string
+
+	// ClientCertFile and ClientKeyFile are a PEM certificate and key presented to servers that request one
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// UserAgent is sent with every request, defaulting to DefaultUserAgent
+	UserAgent string
+
+	// Headers are sent with every request
+	Headers http.Header
+}
+
+// NewHttpClient creates a dedicated HTTP client for downloads
+func NewHttpClient(opts ClientOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.ProxyUrl != "" {
+		proxyUrl, err := url.Parse(opts.ProxyUrl)
+		if err != nil || proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProxyUrl, opts.ProxyUrl)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	return &http.Client{
+		Transport: &headerTransport{
+			next:      transport,
+			userAgent: userAgent,
+			headers:   opts.Headers.Clone(),
+		},
+	}, nil
+}
+
+func (o ClientOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if o.CaFile != "" {
+		pem, err := os.ReadFile(o.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCaFile, err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates found in %v", ErrInvalidCaFile, o.CaFile)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if (o.ClientCertFile == "") != (o.ClientKeyFile == "") {
+		return nil, ErrIncompleteClientKey
+	}
+
+	if o.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.ClientCertFile, o.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidClientCert, err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// headerSeparatorRegexp matches where the next header starts, a newline or a semicolon followed by a header name and a
+// colon or the end of the headers. Semicolons within a value, as in "Cookie: a=1; b=2" or "Accept: text/html; q=0.9", don't start a new header.
+var headerSeparatorRegexp = regexp.MustCompile(`\n|;[ \t]*([!#$%&'*+.^_|~0-9A-Za-z-]+[ \t]*:|$)`)
+
+// ParseHeaders parses headers in the form "Name: value; Other-Name: other value", or one per line
+func ParseHeaders(headers string) (http.Header, error) {
+	parsed := make(http.Header)
+	for _, header := range splitHeaders(headers) {
+		if strings.TrimSpace(header) == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, strings.TrimSpace(header))
+		}
+
+		parsed.Add(name, strings.TrimSpace(value))
+	}
+
+	return parsed, nil
+}
+
+// splitHeaders splits headers at each separator, keeping the name that follows a semicolon with its header
+func splitHeaders(headers string) []string {
+	split := make([]string, 0)
+	start := 0
+	for _, match := range headerSeparatorRegexp.FindAllStringIndex(headers, -1) {
+		split = append(split, headers[start:match[0]])
+		start = match[0] + 1
+	}
+
+	return append(split, headers[start:])
+}
+
+// headerTransport adds the configured user agent to every request, and the configured headers to requests to the
+// host first requested. The headers are often credentials, so they aren't sent on when a redirect leads elsewhere.
+type headerTransport struct {
+	next      http.RoundTripper
+	userAgent string
+	headers   http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Round trippers must not modify the original request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	if req.URL.Host == initialRequest(req).URL.Host {
+		for name, values := range t.headers {
+			req.Header.Del(name)
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// initialRequest follows a redirected request back to the request the client was first asked to make
+func initialRequest(req *http.Request) *http.Request {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+
+	return req
+}
@@ -0,0 +1,283 @@
+package download
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeServerCa writes the test server's certificate to a file, so it can be trusted as a CA
+func writeServerCa(t *testing.T, server *httptest.Server) string {
+	path := t.TempDir() + "/ca.pem"
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(path, caPem, 0600))
+
+	return path
+}
+
+// writeClientCert generates a self-signed client certificate and key, returning their paths
+func writeClientCert(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ukcp-srd-tools-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	certDer, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certPath := dir + "/client.pem"
+	keyPath := dir + "/client-key.pem"
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	return certPath, keyPath
+}
+
+func TestNewHttpClient_UserAgentAndHeaders(t *testing.T) {
+	tests := []struct {
+		name              string
+		opts              ClientOptions
+		expectedUserAgent string
+		expectedHeaders   map[string]string
+	}{
+		{
+			name:              "defaults",
+			opts:              ClientOptions{},
+			expectedUserAgent: DefaultUserAgent,
+		},
+		{
+			name: "custom user agent and headers",
+			opts: ClientOptions{
+				UserAgent: "my-agent/1.0",
+				Headers:   http.Header{"X-Api-Key": []string{"secret"}, "X-Other": []string{"value"}},
+			},
+			expectedUserAgent: "my-agent/1.0",
+			expectedHeaders:   map[string]string{"X-Api-Key": "secret", "X-Other": "value"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+
+			var received http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header.Clone()
+			}))
+			defer server.Close()
+
+			client, err := NewHttpClient(tt.opts)
+			require.NoError(err)
+
+			resp, err := client.Get(server.URL)
+			require.NoError(err)
+			resp.Body.Close()
+
+			require.Equal(tt.expectedUserAgent, received.Get("User-Agent"))
+			for name, value := range tt.expectedHeaders {
+				require.Equal(value, received.Get(name))
+			}
+		})
+	}
+}
+
+func TestNewHttpClient_HeadersNotSentToRedirectedHost(t *testing.T) {
+	require := require.New(t)
+
+	received := make(map[string]http.Header)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received["other"] = r.Header.Clone()
+	}))
+	defer other.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received[r.URL.Path] = r.Header.Clone()
+		switch r.URL.Path {
+		case "/same-host":
+			http.Redirect(w, r, "/SRD.zip", http.StatusFound)
+		case "/other-host":
+			http.Redirect(w, r, other.URL+"/SRD.zip", http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+
+	client, err := NewHttpClient(ClientOptions{
+		Headers: http.Header{"Authorization": []string{"Bearer secret"}, "X-Api-Key": []string{"secret"}},
+	})
+	require.NoError(err)
+
+	// A redirect on the same host keeps the headers
+	resp, err := client.Get(origin.URL + "/same-host")
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal("Bearer secret", received["/SRD.zip"].Get("Authorization"))
+	require.Equal("secret", received["/SRD.zip"].Get("X-Api-Key"))
+
+	// A redirect to another host doesn't
+	resp, err = client.Get(origin.URL + "/other-host")
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal("secret", received["/other-host"].Get("X-Api-Key"))
+	require.Empty(received["other"].Get("Authorization"))
+	require.Empty(received["other"].Get("X-Api-Key"))
+	require.Equal(DefaultUserAgent, received["other"].Get("User-Agent"))
+}
+
+func TestNewHttpClient_Proxy(t *testing.T) {
+	require := require.New(t)
+
+	var proxiedUrl string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedUrl = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := NewHttpClient(ClientOptions{ProxyUrl: proxy.URL})
+	require.NoError(err)
+
+	resp, err := client.Get("http://srd.example.com/SRD.zip")
+	require.NoError(err)
+	resp.Body.Close()
+
+	require.Equal("http://srd.example.com/SRD.zip", proxiedUrl)
+}
+
+func TestNewHttpClient_CaFile(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// Without the CA, the server isn't trusted
+	client, err := NewHttpClient(ClientOptions{})
+	require.NoError(err)
+	_, err = client.Get(server.URL)
+	require.Error(err)
+
+	client, err = NewHttpClient(ClientOptions{CaFile: writeServerCa(t, server)})
+	require.NoError(err)
+
+	resp, err := client.Get(server.URL)
+	require.NoError(err)
+	resp.Body.Close()
+}
+
+func TestNewHttpClient_ClientCertificate(t *testing.T) {
+	require := require.New(t)
+
+	var peerCertificates int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCertificates = len(r.TLS.PeerCertificates)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	certPath, keyPath := writeClientCert(t)
+	client, err := NewHttpClient(ClientOptions{
+		CaFile:         writeServerCa(t, server),
+		ClientCertFile: certPath,
+		ClientKeyFile:  keyPath,
+	})
+	require.NoError(err)
+
+	resp, err := client.Get(server.URL)
+	require.NoError(err)
+	resp.Body.Close()
+
+	require.Equal(1, peerCertificates)
+}
+
+func TestNewHttpClient_Errors(t *testing.T) {
+	emptyFile := t.TempDir() + "/empty.pem"
+	require.NoError(t, os.WriteFile(emptyFile, []byte("not a certificate"), 0600))
+
+	tests := []struct {
+		name        string
+		opts        ClientOptions
+		expectedErr error
+	}{
+		{"invalid proxy", ClientOptions{ProxyUrl: "not a url"}, ErrInvalidProxyUrl},
+		{"missing ca file", ClientOptions{CaFile: "/does/not/exist.pem"}, ErrInvalidCaFile},
+		{"ca file without certificates", ClientOptions{CaFile: emptyFile}, ErrInvalidCaFile},
+		{"client cert without key", ClientOptions{ClientCertFile: emptyFile}, ErrIncompleteClientKey},
+		{"client key without cert", ClientOptions{ClientKeyFile: emptyFile}, ErrIncompleteClientKey},
+		{"invalid client cert", ClientOptions{ClientCertFile: emptyFile, ClientKeyFile: emptyFile}, ErrInvalidClientCert},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHttpClient(tt.opts)
+			require.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		headers     string
+		expected    http.Header
+		expectedErr error
+	}{
+		{"empty", "", http.Header{}, nil},
+		{"single", "X-Api-Key: secret", http.Header{"X-Api-Key": []string{"secret"}}, nil},
+		{
+			"multiple with whitespace",
+			" X-Api-Key: secret ;x-other:value with spaces; ",
+			http.Header{"X-Api-Key": []string{"secret"}, "X-Other": []string{"value with spaces"}},
+			nil,
+		},
+		{"value containing colon", "X-Forwarded: http://example.com", http.Header{"X-Forwarded": []string{"http://example.com"}}, nil},
+		{
+			"semicolons within values",
+			"Cookie: session=abc; theme=dark; Accept: text/html; q=0.9",
+			http.Header{"Cookie": []string{"session=abc; theme=dark"}, "Accept": []string{"text/html; q=0.9"}},
+			nil,
+		},
+		{
+			"one per line",
+			"Cookie: session=abc; theme=dark\nX-Api-Key: secret\n",
+			http.Header{"Cookie": []string{"session=abc; theme=dark"}, "X-Api-Key": []string{"secret"}},
+			nil,
+		},
+		{"missing colon", "X-Api-Key secret", nil, ErrInvalidHeader},
+		{"missing name", ": secret", nil, ErrInvalidHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers, err := ParseHeaders(tt.headers)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, headers)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/html"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+)
+
+// DefaultIndexUrl is the NATS digital datasets page that links to each SRD archive
+const DefaultIndexUrl = "https://nats-uk.ead-it.com/cms-nats/opencms/en/Publications/digital-datasets/"
+
+// maxIndexPageSize is the most we will read of the index page
+const maxIndexPageSize = 10 * 1024 * 1024
+
+var (
+	ErrIndexUnavailable = errors.New("unable to fetch SRD index page")
+	ErrNoLinkForCycle   = errors.New("no SRD link found on index page for cycle")
+)
+
+// UrlOptions controls how the download URL for a cycle is worked out
+type UrlOptions struct {
+	// Template is the URL template used when discovery is disabled or fails
+	Template string
+
+	// Discover enables searching the index page for the cycle's archive
+	Discover bool
+
+	// IndexUrl is the page searched for links when discovering
+	IndexUrl string
+}
+
+// ResolveUrl works out the URL to download the SRD for a cycle from. If discovery is enabled, the index page
+// is searched for a link to the cycle's archive, falling back to the templated URL if one can't be found.
+func ResolveUrl(ctx context.Context, client *http.Client, cycle *airac.AiracCycle, opts UrlOptions) (string, error) {
+	urlTemplate := opts.Template
+	if urlTemplate == "" {
+		urlTemplate = DefaultUrlTemplate
+	}
+
+	templatedUrl, err := TemplateUrl(urlTemplate, cycle)
+	if err != nil {
+		return "", err
+	}
+
+	if !opts.Discover {
+		return templatedUrl, nil
+	}
+
+	indexUrl := opts.IndexUrl
+	if indexUrl == "" {
+		indexUrl = DefaultIndexUrl
+	}
+
+	discoveredUrl, err := DiscoverUrl(ctx, client, indexUrl, cycle)
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to discover SRD download URL, falling back to %v", templatedUrl)
+		return templatedUrl, nil
+	}
+
+	log.Info().Msgf("discovered SRD download URL %v", discoveredUrl)
+	return discoveredUrl, nil
+}
+
+// DiscoverUrl fetches the index page and returns the absolute URL of the archive linked for the cycle
+func DiscoverUrl(ctx context.Context, client *http.Client, indexUrl string, cycle *airac.AiracCycle) (string, error) {
+	log.Debug().Msgf("Searching %v for the SRD archive for cycle %v", indexUrl, cycle.Ident)
+
+	base, err := url.Parse(indexUrl)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrIndexUnavailable, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", indexUrl, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrIndexUnavailable, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrIndexUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: status code was %s", ErrIndexUnavailable, resp.Status)
+	}
+
+	links, err := archiveLinks(io.LimitReader(resp.Body, maxIndexPageSize))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrIndexUnavailable, err)
+	}
+
+	matcher := cycleLinkRegexp(cycle)
+	for _, link := range links {
+		if !isSrdLink(link) || (!matcher.MatchString(link.href) && !matcher.MatchString(link.text)) {
+			continue
+		}
+
+		ref, err := url.Parse(link.href)
+		if err != nil {
+			log.Debug().Err(err).Msgf("Ignoring unparseable link %v", link.href)
+			continue
+		}
+
+		return base.ResolveReference(ref).String(), nil
+	}
+
+	return "", fmt.Errorf("%w %v", ErrNoLinkForCycle, cycle.Ident)
+}
+
+type pageLink struct {
+	href string
+	text string
+}
+
+// archiveLinks returns all of the links to zip archives on the page, along with their text
+func archiveLinks(body io.Reader) ([]pageLink, error) {
+	doc, err := html.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]pageLink, 0)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			for _, attr := range n.Attr {
+				if attr.Key == "href" && isArchiveLink(attr.Val) {
+					links = append(links, pageLink{href: attr.Val, text: nodeText(n)})
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return links, nil
+}
+
+func isArchiveLink(href string) bool {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(path.Ext(ref.Path), ".zip")
+}
+
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return strings.TrimSpace(sb.String())
+}
+
+// srdLinkRegexp matches the ways the SRD is named in links, other datasets are published for each cycle too
+var srdLinkRegexp = regexp.MustCompile(`(?i)(^|[^a-z])SRD([^a-z]|$)|Standard[-_ ]Route[-_ ]Document`)
+
+// isSrdLink reports whether the link names the SRD in its href or text
+func isSrdLink(link pageLink) bool {
+	return srdLinkRegexp.MatchString(link.href) || srdLinkRegexp.MatchString(link.text)
+}
+
+// cycleLinkRegexp matches the ways a cycle is written in SRD links, e.g. AIRAC-01-2025, 01/2025, 2025-01 or AIRAC 2501
+func cycleLinkRegexp(cycle *airac.AiracCycle) *regexp.Regexp {
+	number, _ := strconv.Atoi(cycle.MonthString())
+	year := strconv.Itoa(cycle.Year())
+
+	return regexp.MustCompile(fmt.Sprintf(
+		`(?i)(^|[^0-9])(0?%d[-_/ ]%s|%s[-_/ ]0?%d|AIRAC[-_ ]?%s)([^0-9]|$)`,
+		number,
+		year,
+		year,
+		number,
+		cycle.Ident,
+	))
+}
@@ -0,0 +1,153 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+)
+
+func getIndexServer(t *testing.T, statusCode int) *httptest.Server {
+	page, err := os.ReadFile("../../test/data/digital-datasets.html")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		_, err := w.Write(page)
+		if err != nil {
+			panic(err)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestDiscoverUrl(t *testing.T) {
+	server := getIndexServer(t, http.StatusOK)
+
+	tests := []struct {
+		name        string
+		ident       string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "link matched on text",
+			ident:    "2501",
+			expected: server.URL + "/cms-nats/export/sites/default/en/Publications/digital-datasets/SRD/Standard-Route-Document-2501.zip?v=2",
+		},
+		{
+			name:     "link matched on href",
+			ident:    "2413",
+			expected: server.URL + "/cms-nats/export/sites/default/en/Publications/digital-datasets/SRD/SRD_AIRAC_13-2024.zip",
+		},
+		{
+			name:     "relative link",
+			ident:    "2502",
+			expected: server.URL + "/SRD/srd-2025-02.ZIP",
+		},
+		{
+			name:        "only other datasets linked for cycle",
+			ident:       "2503",
+			expectedErr: ErrNoLinkForCycle,
+		},
+		{
+			name:        "no link for cycle",
+			ident:       "2504",
+			expectedErr: ErrNoLinkForCycle,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cycle, err := airac.NewAirac(nil).CycleFromIdent(tt.ident)
+			require.NoError(t, err)
+
+			result, err := DiscoverUrl(context.Background(), http.DefaultClient, server.URL+"/", cycle)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestDiscoverUrl_IndexUnavailable(t *testing.T) {
+	server := getIndexServer(t, http.StatusNotFound)
+	cycle, err := airac.NewAirac(nil).CycleFromIdent("2501")
+	require.NoError(t, err)
+
+	_, err = DiscoverUrl(context.Background(), http.DefaultClient, server.URL, cycle)
+	require.ErrorIs(t, err, ErrIndexUnavailable)
+}
+
+func TestResolveUrl(t *testing.T) {
+	server := getIndexServer(t, http.StatusOK)
+	unavailable := getIndexServer(t, http.StatusInternalServerError)
+
+	tests := []struct {
+		name     string
+		ident    string
+		opts     UrlOptions
+		expected string
+	}{
+		{
+			name:     "default template",
+			ident:    "2503",
+			opts:     UrlOptions{},
+			expected: "https://nats-uk.ead-it.com/cms-nats/export/sites/default/en/Publications/digital-datasets/SRD/AIRAC-03-2025.zip",
+		},
+		{
+			name:     "custom template",
+			ident:    "2503",
+			opts:     UrlOptions{Template: "https://example.com/SRD_{{.Ident}}.zip"},
+			expected: "https://example.com/SRD_2503.zip",
+		},
+		{
+			name:     "discovered",
+			ident:    "2501",
+			opts:     UrlOptions{Discover: true, IndexUrl: server.URL, Template: "https://example.com/SRD_{{.Ident}}.zip"},
+			expected: server.URL + "/cms-nats/export/sites/default/en/Publications/digital-datasets/SRD/Standard-Route-Document-2501.zip?v=2",
+		},
+		{
+			name:     "discovery falls back when no link",
+			ident:    "2503",
+			opts:     UrlOptions{Discover: true, IndexUrl: server.URL, Template: "https://example.com/SRD_{{.Ident}}.zip"},
+			expected: "https://example.com/SRD_2503.zip",
+		},
+		{
+			name:     "discovery falls back when index unavailable",
+			ident:    "2501",
+			opts:     UrlOptions{Discover: true, IndexUrl: unavailable.URL, Template: "https://example.com/SRD_{{.Ident}}.zip"},
+			expected: "https://example.com/SRD_2501.zip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cycle, err := airac.NewAirac(nil).CycleFromIdent(tt.ident)
+			require.NoError(t, err)
+
+			result, err := ResolveUrl(context.Background(), http.DefaultClient, cycle, tt.opts)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestResolveUrl_InvalidTemplate(t *testing.T) {
+	cycle, err := airac.NewAirac(nil).CycleFromIdent("2501")
+	require.NoError(t, err)
+
+	_, err = ResolveUrl(context.Background(), http.DefaultClient, cycle, UrlOptions{Template: "{{.Nope"})
+	require.ErrorIs(t, err, ErrInvalidUrlTemplate)
+}
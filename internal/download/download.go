@@ -1,7 +1,6 @@
 package download
 
 import (
-	"archive/zip"
 	"context"
 	"errors"
 	"fmt"
@@ -9,17 +8,62 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/progress"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/tracing"
 )
 
 type SrdDownloader struct {
 	cycle              *airac.AiracCycle
 	loadedCycle        loadedAirac
-	latestDownloadFile *os.File
+	fileDir            string
+	latestDownloadPath string
 	downloadUrl        string
+	extractOptions     ExtractOptions
+	stage              bool
+	client             *http.Client
+	progress           progress.Reporter
+}
+
+// Option configures optional behaviour of the SrdDownloader
+type Option func(*SrdDownloader)
+
+// WithExtractOptions sets the limits used when extracting the workbook from the downloaded archive
+func WithExtractOptions(opts ExtractOptions) Option {
+	return func(d *SrdDownloader) {
+		if opts.WorkbookPattern == nil {
+			opts.WorkbookPattern = DefaultWorkbookPattern
+		}
+
+		d.extractOptions = opts
+	}
+}
+
+// WithHttpClient sets the HTTP client used to download the SRD, see NewHttpClient
+func WithHttpClient(client *http.Client) Option {
+	return func(d *SrdDownloader) {
+		d.client = client
+	}
+}
+
+// WithProgress sets a reporter that receives the number of bytes downloaded as the download progresses
+func WithProgress(reporter progress.Reporter) Option {
+	return func(d *SrdDownloader) {
+		d.progress = reporter
+	}
+}
+
+// WithStaging makes the downloader stage the SRD for later import, rather than replacing the latest download.
+// This is used to fetch the next cycle's SRD ahead of its effective date.
+func WithStaging() Option {
+	return func(d *SrdDownloader) {
+		d.stage = true
+	}
 }
 
 type loadedAirac interface {
@@ -30,50 +74,122 @@ type loadedAirac interface {
 var (
 	ErrFailedToScanLoadedCycle = errors.New("failed to scan loaded cycle file")
 	ErrUpToDate                = errors.New("SRD is up to date")
+	ErrAlreadyStaged           = errors.New("SRD is already staged")
+	ErrNotYetAvailable         = errors.New("SRD is not yet available to download")
 	ErrLoadedChecksumFailed    = errors.New("failed to calculate checksum of loaded cycle file")
 	ErrDownloadChecksumFailed  = errors.New("failed to calculate checksum of downloaded cycle file")
 )
 
-func NewSrdDownloader(cycle *airac.AiracCycle, loadedCycle loadedAirac, fileDir, downloadUrl string) (*SrdDownloader, error) {
-	latestDownloadFile, err := loadLatestDownloadFile(fileDir)
+func NewSrdDownloader(cycle *airac.AiracCycle, loadedCycle loadedAirac, fileDir, downloadUrl string, opts ...Option) (*SrdDownloader, error) {
+	info, err := os.Stat(fileDir)
 	if err != nil {
 		return nil, err
 	}
 
-	return &SrdDownloader{
+	if !info.IsDir() {
+		return nil, fmt.Errorf("download location %v is not a directory", fileDir)
+	}
+
+	d := &SrdDownloader{
 		cycle:              cycle,
 		loadedCycle:        loadedCycle,
-		latestDownloadFile: latestDownloadFile,
+		fileDir:            fileDir,
+		latestDownloadPath: filePath(fileDir, latestDownloadBaseName+".xlsx"),
 		downloadUrl:        downloadUrl,
-	}, nil
+		extractOptions:     DefaultExtractOptions(),
+		client:             http.DefaultClient,
+		progress:           progress.Discard,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d, nil
 }
 
 func (d *SrdDownloader) Download(ctx context.Context, force bool) error {
+	start := time.Now()
 	log.Debug().Msg("Starting SRD download")
 	log.Debug().Msg("Checking if SRD is up to date")
 	log.Debug().Msgf("Loaded cycle is %v", d.loadedCycle.Ident())
 	log.Debug().Msgf("Latest cycle is %v", d.cycle.Ident)
 
-	// We already have the latest cycle
-	if d.loadedCycle.Is(d.cycle.Ident) && !force {
-		log.Info().Msg("SRD is up to date")
-		return ErrUpToDate
+	if d.stage {
+		// We've already staged this cycle
+		if stagedPath, ok := StagedFile(d.fileDir, d.cycle.Ident); ok && !force {
+			log.Info().Str("cycle", d.cycle.Ident).Str("file", stagedPath).Msgf("SRD for cycle %v is already staged at %v", d.cycle.Ident, stagedPath)
+			return ErrAlreadyStaged
+		}
+	} else {
+		// We already have the latest cycle
+		if d.loadedCycle.Is(d.cycle.Ident) && !force {
+			log.Info().Str("cycle", d.cycle.Ident).Msg("SRD is up to date")
+			return ErrUpToDate
+		}
+
+		// We've downloaded this cycle ahead of time, so use that
+		if stagedPath, ok := StagedFile(d.fileDir, d.cycle.Ident); ok && !force {
+			return d.promoteStaged(stagedPath)
+		}
+	}
+
+	// So we need to download the latest cycle, into a temporary file
+	tempFile, err := os.CreateTemp(d.fileDir, "ukcp-srd-import-download")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	err = d.downloadArchive(ctx, tempFile)
+	if err != nil {
+		return err
+	}
+
+	// Unzip and extract the Excel file from the temp file
+	baseName := latestDownloadBaseName
+	if d.stage {
+		baseName = stagedBaseName(d.cycle.Ident)
 	}
 
-	// So we need to download the latest cycle
-	client := http.DefaultClient
+	unzipCtx, span := tracing.Start(ctx, "download.unzip")
+	workbookPath, err := extractWorkbook(unzipCtx, tempFile.Name(), d.fileDir, baseName, d.extractOptions)
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+
+	d.latestDownloadPath = workbookPath
+
+	if d.stage {
+		log.Info().Str("cycle", d.cycle.Ident).Str("file", workbookPath).Msgf("staged SRD for cycle %v at %v", d.cycle.Ident, workbookPath)
+	}
+
+	log.Info().Str("cycle", d.cycle.Ident).Str("url", d.downloadUrl).Str("file", workbookPath).Dur("duration", time.Since(start)).Msg("finished SRD download")
+	return nil
+}
+
+// downloadArchive downloads the SRD archive into the temporary file, which is closed once it has been written
+func (d *SrdDownloader) downloadArchive(ctx context.Context, tempFile *os.File) (err error) {
+	ctx, span := tracing.Start(ctx, "download.http", attribute.String("url.full", d.downloadUrl))
+	defer func() { tracing.End(span, err) }()
+
+	// Closing it again once it has been closed below does nothing
+	defer tempFile.Close()
+
 	log.Debug().Msgf("Downloading SRD file from %v", d.downloadUrl)
 	req, err := http.NewRequestWithContext(ctx, "GET", d.downloadUrl, nil)
 	if err != nil {
 		return err
 	}
 
-	resp, err := client.Do(req)
+	resp, err := d.client.Do(req)
 	if err != nil {
 		return err
 	}
 
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK {
 		msg := fmt.Sprintf("unable to download SRD, status code was %s", resp.Status)
@@ -81,19 +197,33 @@ func (d *SrdDownloader) Download(ctx context.Context, force bool) error {
 		return errors.New(msg)
 	}
 
-	// Write the response body into a temporary file
-	tempFile, err := os.CreateTemp("/tmp", "ukcp-srd-import-download")
-	if err != nil {
-		return err
+	// Reject the archive early if the server tells us it's too big
+	maxArchiveSize := d.extractOptions.MaxArchiveSize
+	if maxArchiveSize > 0 && resp.ContentLength > maxArchiveSize {
+		log.Error().Msgf("downloaded archive is %v bytes, the maximum is %v", resp.ContentLength, maxArchiveSize)
+		return ErrArchiveTooLarge
 	}
 
-	_, err = io.Copy(tempFile, resp.Body)
-	if err != nil {
+	limit := int64(-1)
+	if maxArchiveSize > 0 {
+		limit = maxArchiveSize
+	}
+
+	// Write the response body into the temporary file
+	body := &progressReader{reader: resp.Body, total: max(resp.ContentLength, 0), report: d.progress}
+	_, err = copyWithLimit(tempFile, body, limit)
+	if errors.Is(err, errLimitExceeded) {
+		log.Error().Msgf("downloaded archive exceeds the maximum of %v bytes", maxArchiveSize)
+		return ErrArchiveTooLarge
+	} else if err != nil {
 		log.Error().Err(err).Msg("failed to write downloaded SRD file to disk")
 		return err
 	}
 
+	body.done()
+	span.SetAttributes(attribute.Int64("bytes", body.read))
 	log.Debug().Msgf("Downloaded SRD file to %v", tempFile.Name())
+
 	// Flush the temporary file to ensure all data is written
 	err = tempFile.Sync()
 	if err != nil {
@@ -102,93 +232,88 @@ func (d *SrdDownloader) Download(ctx context.Context, force bool) error {
 	}
 
 	// Close the temp file before unzipping
-	err = tempFile.Close()
-	if err != nil {
-		return err
-	}
+	return tempFile.Close()
+}
 
-	// Unzip and extract the Excel file from the temp file
-	err = d.unzipAndExtractExcel(tempFile.Name())
-	if err != nil {
-		return err
-	}
+// Available checks whether the SRD can be downloaded, without downloading it
+func (d *SrdDownloader) Available(ctx context.Context) (bool, error) {
+	log.Debug().Msgf("Checking whether SRD is available at %v", d.downloadUrl)
 
-	// Delete the temporary file
-	err = os.Remove(tempFile.Name())
+	req, err := http.NewRequestWithContext(ctx, "HEAD", d.downloadUrl, nil)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	log.Info().Msg("finished SRD download")
-	return d.completeDownload()
-}
-
-func (d *SrdDownloader) unzipAndExtractExcel(zipFilePath string) error {
-	log.Debug().Msgf("Unzipping SRD file from %v", zipFilePath)
-
-	// Open the zip file
-	reader, err := zip.OpenReader(zipFilePath)
+	resp, err := d.client.Do(req)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to open zip file")
-		return fmt.Errorf("failed to open zip file: %v", err)
+		return false, err
 	}
-	defer reader.Close()
-
-	// Look for .xlsx file in the zip
-	var excelFile *zip.File
-	for _, f := range reader.File {
-		if filepath.Ext(f.Name) == ".xlsx" {
-			excelFile = f
-			break
+	resp.Body.Close()
+
+	// Some servers don't support HEAD requests, so fall back to a GET that we don't read the body of
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		log.Debug().Msgf("HEAD request not supported, status code was %s, falling back to GET", resp.Status)
+		req, err = http.NewRequestWithContext(ctx, "GET", d.downloadUrl, nil)
+		if err != nil {
+			return false, err
 		}
-	}
 
-	if excelFile == nil {
-		return errors.New("no .xlsx file found in downloaded zip")
+		resp, err = d.client.Do(req)
+		if err != nil {
+			return false, err
+		}
+		resp.Body.Close()
 	}
 
-	// Open the Excel file from the zip
-	rc, err := excelFile.Open()
-	if err != nil {
-		log.Error().Err(err).Msg("failed to open excel file from zip")
-		return err
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return true, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusGone:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unable to check SRD availability, status code was %s", resp.Status)
 	}
-	defer rc.Close()
+}
 
-	// Truncate the download file and seek to start
-	err = d.latestDownloadFile.Truncate(0)
-	if err != nil {
-		return err
-	}
+func (d *SrdDownloader) LatestFileLocation() string {
+	return d.latestDownloadPath
+}
 
-	_, err = d.latestDownloadFile.Seek(0, 0)
-	if err != nil {
-		return err
-	}
+// promoteStaged makes a previously staged SRD the latest download
+func (d *SrdDownloader) promoteStaged(stagedPath string) error {
+	log.Info().Str("cycle", d.cycle.Ident).Str("file", stagedPath).Msgf("using SRD for cycle %v staged at %v", d.cycle.Ident, stagedPath)
 
-	// Write the Excel file content to the download file
-	_, err = io.Copy(d.latestDownloadFile, rc)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to extract excel file from zip")
+	destination := filePath(d.fileDir, latestDownloadBaseName+filepath.Ext(stagedPath))
+	if err := os.Rename(stagedPath, destination); err != nil {
 		return err
 	}
 
-	log.Debug().Msg("Successfully unzipped and extracted Excel file")
+	d.latestDownloadPath = destination
 	return nil
 }
 
-func (d *SrdDownloader) LatestFileLocation() string {
-	return d.latestDownloadFile.Name()
+// progressReader reports the number of bytes read through it
+type progressReader struct {
+	reader io.Reader
+	read   int64
+	total  int64
+	report progress.Reporter
 }
 
-func (d *SrdDownloader) completeDownload() error {
-	return d.latestDownloadFile.Close()
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		r.report(progress.Event{Stage: progress.StageDownload, Current: r.read, Total: r.total})
+	}
+
+	return n, err
 }
 
-func filePath(dir, file string) string {
-	return fmt.Sprintf("%s/%s", dir, file)
+func (r *progressReader) done() {
+	r.report(progress.Event{Stage: progress.StageDownload, Current: r.read, Total: r.total, Done: true})
 }
 
-func loadLatestDownloadFile(dir string) (*os.File, error) {
-	return os.OpenFile(filePath(dir, "ukcp-srd-import-loaded-download.xlsx"), os.O_RDWR|os.O_CREATE, 0600)
+func filePath(dir, file string) string {
+	return fmt.Sprintf("%s/%s", dir, file)
 }
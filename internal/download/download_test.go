@@ -10,8 +10,13 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/progress"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/tracing"
 )
 
 type testServer struct {
@@ -196,3 +201,203 @@ func (m *mockLoadedAirac) Ident() string {
 func (m *mockLoadedAirac) Is(ident string) bool {
 	return m.ident == ident
 }
+
+func TestDownloader_Available(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		expected    bool
+		expectedErr bool
+	}{
+		{"available", http.StatusOK, true, false},
+		{"not found", http.StatusNotFound, false, false},
+		{"forbidden", http.StatusForbidden, false, false},
+		{"server error", http.StatusInternalServerError, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+
+			ts := getTestServer(tt.statusCode, "")
+			defer ts.server.Close()
+
+			cycle := airac.NewAirac(nil).NextCycle()
+			d, err := NewSrdDownloader(cycle, &mockLoadedAirac{ident: ""}, t.TempDir(), ts.server.URL)
+			require.NoError(err)
+
+			available, err := d.Available(context.Background())
+			if tt.expectedErr {
+				require.Error(err)
+			} else {
+				require.NoError(err)
+			}
+			require.Equal(tt.expected, available)
+			require.Equal(1, ts.callCount)
+		})
+	}
+}
+
+func TestDownloader_AvailableFallsBackToGet(t *testing.T) {
+	require := require.New(t)
+
+	methods := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cycle := airac.NewAirac(nil).NextCycle()
+	d, err := NewSrdDownloader(cycle, &mockLoadedAirac{ident: ""}, t.TempDir(), server.URL)
+	require.NoError(err)
+
+	available, err := d.Available(context.Background())
+	require.NoError(err)
+	require.True(available)
+	require.Equal([]string{http.MethodHead, http.MethodGet}, methods)
+}
+
+func TestDownloader_Staging(t *testing.T) {
+	require := require.New(t)
+	tempDir := t.TempDir()
+
+	ts := &testServer{statusCode: http.StatusOK, body: createZipWithExcel("next cycle content")}
+	ts.server = httptest.NewServer(ts)
+	defer ts.server.Close()
+
+	// The current download should be left alone when staging
+	current := tempDir + "/ukcp-srd-import-loaded-download.xlsx"
+	require.NoError(os.WriteFile(current, []byte("current cycle content"), 0600))
+
+	airacManager := airac.NewAirac(nil)
+	currentCycle := airacManager.CurrentCycle()
+	nextCycle := airacManager.NextCycle()
+
+	d, err := NewSrdDownloader(nextCycle, &mockLoadedAirac{ident: currentCycle.Ident}, tempDir, ts.server.URL, WithStaging())
+	require.NoError(err)
+	require.NoError(d.Download(context.Background(), false))
+
+	stagedPath, ok := StagedFile(tempDir, nextCycle.Ident)
+	require.True(ok)
+	require.Equal(tempDir+"/ukcp-srd-import-staged-"+nextCycle.Ident+".xlsx", stagedPath)
+	require.Equal(stagedPath, d.LatestFileLocation())
+
+	content, err := os.ReadFile(stagedPath)
+	require.NoError(err)
+	require.Equal("next cycle content", string(content))
+
+	content, err = os.ReadFile(current)
+	require.NoError(err)
+	require.Equal("current cycle content", string(content))
+
+	// Staging again shouldn't download anything
+	d, err = NewSrdDownloader(nextCycle, &mockLoadedAirac{ident: currentCycle.Ident}, tempDir, ts.server.URL, WithStaging())
+	require.NoError(err)
+	require.ErrorIs(d.Download(context.Background(), false), ErrAlreadyStaged)
+	require.Equal(1, ts.callCount)
+
+	// Unless forced
+	require.NoError(d.Download(context.Background(), true))
+	require.Equal(2, ts.callCount)
+}
+
+func TestDownloader_UsesStagedFile(t *testing.T) {
+	require := require.New(t)
+	tempDir := t.TempDir()
+
+	ts := &testServer{statusCode: http.StatusOK, body: createZipWithExcel("downloaded content")}
+	ts.server = httptest.NewServer(ts)
+	defer ts.server.Close()
+
+	cycle := airac.NewAirac(nil).CurrentCycle()
+	staged := tempDir + "/ukcp-srd-import-staged-" + cycle.Ident + ".xlsx"
+	require.NoError(os.WriteFile(staged, []byte("staged content"), 0600))
+
+	d, err := NewSrdDownloader(cycle, &mockLoadedAirac{ident: ""}, tempDir, ts.server.URL)
+	require.NoError(err)
+	require.NoError(d.Download(context.Background(), false))
+
+	// The staged file should have become the latest download, without a request being made
+	require.Equal(0, ts.callCount)
+	require.Equal(tempDir+"/ukcp-srd-import-loaded-download.xlsx", d.LatestFileLocation())
+
+	content, err := os.ReadFile(d.LatestFileLocation())
+	require.NoError(err)
+	require.Equal("staged content", string(content))
+
+	_, ok := StagedFile(tempDir, cycle.Ident)
+	require.False(ok)
+}
+
+func TestDownloader_ReportsProgress(t *testing.T) {
+	require := require.New(t)
+
+	zipBody := createZipWithExcel("test excel content")
+	ts := &testServer{statusCode: http.StatusOK, body: zipBody}
+	ts.server = httptest.NewServer(ts)
+	defer ts.server.Close()
+
+	events := make([]progress.Event, 0)
+	reporter := func(e progress.Event) {
+		events = append(events, e)
+	}
+
+	cycle := airac.NewAirac(nil).CurrentCycle()
+	d, err := NewSrdDownloader(cycle, &mockLoadedAirac{ident: ""}, t.TempDir(), ts.server.URL, WithProgress(reporter))
+	require.NoError(err)
+	require.NoError(d.Download(context.Background(), false))
+
+	require.NotEmpty(events)
+	last := events[len(events)-1]
+	require.Equal(progress.Event{
+		Stage:   progress.StageDownload,
+		Current: int64(len(zipBody)),
+		Total:   int64(len(zipBody)),
+		Done:    true,
+	}, last)
+
+	for _, e := range events[:len(events)-1] {
+		require.Equal(progress.StageDownload, e.Stage)
+		require.False(e.Done)
+	}
+}
+
+func TestDownloader_Traces(t *testing.T) {
+	require := require.New(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown := tracing.SetupExporter(exporter)
+	defer shutdown(context.Background())
+
+	zipBody := createZipWithExcel("test excel content")
+	ts := &testServer{statusCode: http.StatusOK, body: zipBody}
+	ts.server = httptest.NewServer(ts)
+	defer ts.server.Close()
+
+	cycle := airac.NewAirac(nil).CurrentCycle()
+	d, err := NewSrdDownloader(cycle, &mockLoadedAirac{ident: ""}, t.TempDir(), ts.server.URL)
+	require.NoError(err)
+	require.NoError(d.Download(context.Background(), false))
+
+	spans := exporter.GetSpans()
+	require.Len(spans, 2)
+	require.Equal("download.http", spans[0].Name)
+	require.Contains(spans[0].Attributes, attribute.Int64("bytes", int64(len(zipBody))))
+	require.Contains(spans[0].Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	require.Equal("download.unzip", spans[1].Name)
+
+	// A failed download is marked as an error
+	exporter.Reset()
+	ts.statusCode = http.StatusInternalServerError
+	require.Error(d.Download(context.Background(), true))
+
+	spans = exporter.GetSpans()
+	require.Len(spans, 1)
+	require.Equal(codes.Error, spans[0].Status.Code)
+}
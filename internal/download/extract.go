@@ -0,0 +1,300 @@
+package download
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultMaxArchiveSize is the largest downloaded archive we will accept, in bytes
+	DefaultMaxArchiveSize = 100 * 1024 * 1024
+
+	// DefaultMaxWorkbookSize is the largest uncompressed workbook we will extract, in bytes
+	DefaultMaxWorkbookSize = 250 * 1024 * 1024
+
+	// DefaultMaxCompressionRatio is the highest uncompressed:compressed ratio we will accept for the workbook
+	DefaultMaxCompressionRatio = 100
+)
+
+// DefaultWorkbookPattern matches the names of workbooks we will extract from the archive
+var DefaultWorkbookPattern = regexp.MustCompile(`(?i)\.xlsx?$`)
+
+var (
+	ErrInvalidArchive           = errors.New("failed to open zip file")
+	ErrArchiveTooLarge          = errors.New("downloaded archive exceeds the maximum allowed size")
+	ErrWorkbookTooLarge         = errors.New("workbook exceeds the maximum allowed uncompressed size")
+	ErrCompressionRatioExceeded = errors.New("workbook exceeds the maximum allowed compression ratio")
+	ErrNoWorkbookFound          = errors.New("no workbook matching the pattern found in downloaded zip")
+	ErrMultipleWorkbooks        = errors.New("multiple workbooks matching the pattern found in downloaded zip")
+	ErrCorruptWorkbook          = errors.New("workbook in downloaded zip is corrupt")
+	ErrUnsupportedCompression   = errors.New("workbook in downloaded zip uses an unsupported compression method")
+)
+
+// ExtractError is returned when a workbook cannot be extracted from the downloaded archive,
+// it records which archive entries were involved and wraps one of the sentinel errors above
+type ExtractError struct {
+	Entries []string
+	Err     error
+}
+
+func (e *ExtractError) Error() string {
+	if len(e.Entries) == 0 {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("%v: %v", e.Err, strings.Join(e.Entries, ", "))
+}
+
+func (e *ExtractError) Unwrap() error {
+	return e.Err
+}
+
+// ExtractOptions controls the limits applied when extracting the SRD workbook from the downloaded archive
+type ExtractOptions struct {
+	// MaxArchiveSize is the maximum size of the downloaded archive, in bytes
+	MaxArchiveSize int64
+
+	// MaxWorkbookSize is the maximum uncompressed size of the workbook, in bytes
+	MaxWorkbookSize int64
+
+	// MaxCompressionRatio is the maximum ratio of uncompressed to compressed size for the workbook
+	MaxCompressionRatio float64
+
+	// WorkbookPattern is matched against the base name of each archive entry to find the workbook
+	WorkbookPattern *regexp.Regexp
+}
+
+// DefaultExtractOptions returns the extraction limits used when none are configured
+func DefaultExtractOptions() ExtractOptions {
+	return ExtractOptions{
+		MaxArchiveSize:      DefaultMaxArchiveSize,
+		MaxWorkbookSize:     DefaultMaxWorkbookSize,
+		MaxCompressionRatio: DefaultMaxCompressionRatio,
+		WorkbookPattern:     DefaultWorkbookPattern,
+	}
+}
+
+// findWorkbook finds the single workbook in the archive that matches the pattern
+func (o ExtractOptions) findWorkbook(reader *zip.Reader) (*zip.File, error) {
+	matches := make([]*zip.File, 0)
+	for _, f := range reader.File {
+		if !isCandidateEntry(f) {
+			continue
+		}
+
+		if o.WorkbookPattern.MatchString(path.Base(f.Name)) {
+			matches = append(matches, f)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, &ExtractError{Err: ErrNoWorkbookFound}
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, 0, len(matches))
+		for _, f := range matches {
+			names = append(names, f.Name)
+		}
+
+		return nil, &ExtractError{Entries: names, Err: ErrMultipleWorkbooks}
+	}
+}
+
+// checkWorkbook checks the declared sizes of the workbook entry against the limits
+func (o ExtractOptions) checkWorkbook(f *zip.File) error {
+	if o.MaxWorkbookSize > 0 && f.UncompressedSize64 > uint64(o.MaxWorkbookSize) {
+		return &ExtractError{Entries: []string{f.Name}, Err: ErrWorkbookTooLarge}
+	}
+
+	if o.MaxCompressionRatio > 0 && f.CompressedSize64 > 0 {
+		ratio := float64(f.UncompressedSize64) / float64(f.CompressedSize64)
+		if ratio > o.MaxCompressionRatio {
+			return &ExtractError{Entries: []string{f.Name}, Err: ErrCompressionRatioExceeded}
+		}
+	}
+
+	return nil
+}
+
+// extractLimit returns the number of bytes we are prepared to read from the workbook entry, and the error for the
+// limit that applies. Entry headers can lie, so this is enforced on the decompressed stream as well as the header.
+func (o ExtractOptions) extractLimit(f *zip.File) (int64, error) {
+	limit, limitErr := int64(-1), error(nil)
+	if o.MaxWorkbookSize > 0 {
+		limit, limitErr = o.MaxWorkbookSize, ErrWorkbookTooLarge
+	}
+
+	if o.MaxCompressionRatio > 0 && f.CompressedSize64 > 0 {
+		ratioLimit := int64(float64(f.CompressedSize64) * o.MaxCompressionRatio)
+		if limit < 0 || ratioLimit < limit {
+			limit, limitErr = ratioLimit, ErrCompressionRatioExceeded
+		}
+	}
+
+	return limit, limitErr
+}
+
+// isCandidateEntry filters out directories and the resource fork files that macOS adds to archives
+func isCandidateEntry(f *zip.File) bool {
+	if f.FileInfo().IsDir() {
+		return false
+	}
+
+	if strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(path.Base(f.Name), "._") {
+		return false
+	}
+
+	return true
+}
+
+// extractWorkbook extracts the SRD workbook from the zip file, writing it to the file dir with the given base name.
+// It returns the path to the extracted workbook, which keeps the extension of the archive entry so the right reader can be used.
+// If the context is cancelled part way through, the partly extracted workbook is removed.
+func extractWorkbook(ctx context.Context, zipFilePath, fileDir, baseName string, opts ExtractOptions) (string, error) {
+	log.Debug().Msgf("Unzipping SRD file from %v", zipFilePath)
+
+	// Open the zip file
+	reader, err := zip.OpenReader(zipFilePath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to open zip file")
+		return "", fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer reader.Close()
+
+	excelFile, err := opts.findWorkbook(&reader.Reader)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to find workbook in zip file")
+		return "", err
+	}
+
+	if err := opts.checkWorkbook(excelFile); err != nil {
+		log.Error().Err(err).Msg("workbook in zip file failed size checks")
+		return "", err
+	}
+
+	log.Debug().Msgf("Extracting workbook %v from zip", excelFile.Name)
+
+	// Open the Excel file from the zip
+	rc, err := openWorkbook(excelFile)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to open excel file from zip")
+		return "", err
+	}
+	defer rc.Close()
+
+	// Extract into a temporary file first, so a failed extraction leaves the previous download intact
+	tempFile, err := os.CreateTemp(fileDir, "ukcp-srd-import-extract")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempFile.Name())
+
+	limit, limitErr := opts.extractLimit(excelFile)
+	checksum := crc32.NewIEEE()
+	written, err := copyWithLimit(io.MultiWriter(tempFile, checksum), &contextReader{ctx: ctx, reader: rc}, limit)
+	if errors.Is(err, errLimitExceeded) {
+		tempFile.Close()
+		err = &ExtractError{Entries: []string{excelFile.Name}, Err: limitErr}
+		log.Error().Err(err).Msg("failed to extract excel file from zip")
+		return "", err
+	} else if err == nil && !matchesHeader(excelFile, written, checksum.Sum32()) {
+		tempFile.Close()
+		err = &ExtractError{Entries: []string{excelFile.Name}, Err: ErrCorruptWorkbook}
+		log.Error().Err(err).Msg("failed to extract excel file from zip")
+		return "", err
+	} else if err != nil {
+		tempFile.Close()
+		log.Error().Err(err).Msg("failed to extract excel file from zip")
+		return "", err
+	}
+
+	if err := tempFile.Close(); err != nil {
+		return "", err
+	}
+
+	destination := filePath(fileDir, baseName+strings.ToLower(filepath.Ext(excelFile.Name)))
+	if err := os.Rename(tempFile.Name(), destination); err != nil {
+		return "", err
+	}
+
+	log.Debug().Msg("Successfully unzipped and extracted Excel file")
+	return destination, nil
+}
+
+var errLimitExceeded = errors.New("read limit exceeded")
+
+// openWorkbook opens the workbook entry for reading. The zip package stops reading an entry at the size in its header,
+// so the entry is decompressed here instead, for the extract limits to apply to what is actually in the archive.
+// The size and checksum are then checked with matchesHeader.
+func openWorkbook(f *zip.File) (io.ReadCloser, error) {
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, &ExtractError{Entries: []string{f.Name}, Err: ErrCorruptWorkbook}
+	}
+
+	switch f.Method {
+	case zip.Store:
+		return io.NopCloser(raw), nil
+	case zip.Deflate:
+		return flate.NewReader(raw), nil
+	}
+
+	return nil, &ExtractError{Entries: []string{f.Name}, Err: ErrUnsupportedCompression}
+}
+
+// matchesHeader reports whether the extracted workbook has the size and checksum recorded in its entry header
+func matchesHeader(f *zip.File, size int64, checksum uint32) bool {
+	if uint64(size) != f.UncompressedSize64 {
+		return false
+	}
+
+	// Like the zip package, a missing checksum isn't treated as a mismatch
+	return f.CRC32 == 0 || checksum == f.CRC32
+}
+
+// contextReader stops reading once its context is cancelled, for copies that would otherwise run to completion
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.reader.Read(p)
+}
+
+// copyWithLimit copies from src to dst, failing if more than limit bytes are available. A negative limit disables the check.
+// It returns the number of bytes copied.
+func copyWithLimit(dst io.Writer, src io.Reader, limit int64) (int64, error) {
+	if limit < 0 {
+		return io.Copy(dst, src)
+	}
+
+	written, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err != nil {
+		return written, err
+	}
+
+	if written > limit {
+		return written, errLimitExceeded
+	}
+
+	return written, nil
+}
@@ -0,0 +1,396 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
+)
+
+type zipEntry struct {
+	name    string
+	content string
+}
+
+func createZip(entries []zipEntry) []byte {
+	buf := new(bytes.Buffer)
+	writer := zip.NewWriter(buf)
+
+	for _, entry := range entries {
+		f, err := writer.Create(entry.name)
+		if err != nil {
+			panic(err)
+		}
+
+		_, err = f.Write([]byte(entry.content))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	return buf.Bytes()
+}
+
+func writeZip(t *testing.T, entries []zipEntry) string {
+	path := t.TempDir() + "/archive.zip"
+	require.NoError(t, os.WriteFile(path, createZip(entries), 0600))
+
+	return path
+}
+
+func TestExtractWorkbook(t *testing.T) {
+	tests := []struct {
+		name             string
+		entries          []zipEntry
+		opts             func(*ExtractOptions)
+		expectedErr      error
+		expectedFile     string
+		expectedContents string
+	}{
+		{
+			name:             "single xlsx",
+			entries:          []zipEntry{{"SRD.xlsx", "xlsx content"}},
+			expectedFile:     "ukcp-srd-import-loaded-download.xlsx",
+			expectedContents: "xlsx content",
+		},
+		{
+			name:             "single xls",
+			entries:          []zipEntry{{"SRD.xls", "xls content"}},
+			expectedFile:     "ukcp-srd-import-loaded-download.xls",
+			expectedContents: "xls content",
+		},
+		{
+			name:             "upper case extension",
+			entries:          []zipEntry{{"SRD.XLSX", "xlsx content"}},
+			expectedFile:     "ukcp-srd-import-loaded-download.xlsx",
+			expectedContents: "xlsx content",
+		},
+		{
+			name: "workbook in a directory alongside other files",
+			entries: []zipEntry{
+				{"AIRAC/", ""},
+				{"AIRAC/README.txt", "readme"},
+				{"AIRAC/SRD.xlsx", "xlsx content"},
+			},
+			expectedFile:     "ukcp-srd-import-loaded-download.xlsx",
+			expectedContents: "xlsx content",
+		},
+		{
+			name: "macOS resource forks are ignored",
+			entries: []zipEntry{
+				{"SRD.xlsx", "xlsx content"},
+				{"__MACOSX/._SRD.xlsx", "resource fork"},
+				{"._SRD.xlsx", "resource fork"},
+			},
+			expectedFile:     "ukcp-srd-import-loaded-download.xlsx",
+			expectedContents: "xlsx content",
+		},
+		{
+			name:        "no workbook",
+			entries:     []zipEntry{{"README.txt", "readme"}},
+			expectedErr: ErrNoWorkbookFound,
+		},
+		{
+			name: "multiple workbooks",
+			entries: []zipEntry{
+				{"SRD.xlsx", "xlsx content"},
+				{"SRD.xls", "xls content"},
+			},
+			expectedErr: ErrMultipleWorkbooks,
+		},
+		{
+			name: "multiple workbooks narrowed by pattern",
+			entries: []zipEntry{
+				{"SRD.xlsx", "xlsx content"},
+				{"SRD_Changes.xlsx", "changes content"},
+			},
+			opts: func(o *ExtractOptions) {
+				o.WorkbookPattern = regexp.MustCompile(`^SRD\.xlsx$`)
+			},
+			expectedFile:     "ukcp-srd-import-loaded-download.xlsx",
+			expectedContents: "xlsx content",
+		},
+		{
+			name:    "workbook too large",
+			entries: []zipEntry{{"SRD.xlsx", "this content is too large"}},
+			opts: func(o *ExtractOptions) {
+				o.MaxWorkbookSize = 5
+			},
+			expectedErr: ErrWorkbookTooLarge,
+		},
+		{
+			name:    "compression ratio exceeded",
+			entries: []zipEntry{{"SRD.xlsx", strings.Repeat("a", 100000)}},
+			opts: func(o *ExtractOptions) {
+				o.MaxCompressionRatio = 10
+			},
+			expectedErr: ErrCompressionRatioExceeded,
+		},
+		{
+			name:    "limits disabled",
+			entries: []zipEntry{{"SRD.xlsx", strings.Repeat("a", 100000)}},
+			opts: func(o *ExtractOptions) {
+				o.MaxWorkbookSize = 0
+				o.MaxCompressionRatio = 0
+			},
+			expectedFile:     "ukcp-srd-import-loaded-download.xlsx",
+			expectedContents: strings.Repeat("a", 100000),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			zipPath := writeZip(t, tt.entries)
+			outDir := t.TempDir()
+
+			opts := DefaultExtractOptions()
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+
+			path, err := extractWorkbook(context.Background(), zipPath, outDir, latestDownloadBaseName, opts)
+			if tt.expectedErr != nil {
+				require.ErrorIs(err, tt.expectedErr)
+
+				var extractErr *ExtractError
+				require.ErrorAs(err, &extractErr)
+
+				// Nothing should be left behind in the output directory
+				files, err := os.ReadDir(outDir)
+				require.NoError(err)
+				require.Empty(files)
+				return
+			}
+
+			require.NoError(err)
+			require.Equal(outDir+"/"+tt.expectedFile, path)
+
+			content, err := os.ReadFile(path)
+			require.NoError(err)
+			require.Equal(tt.expectedContents, string(content))
+		})
+	}
+}
+
+// writeLyingZip writes an archive with a single deflated workbook, whose header declares the given uncompressed size
+// and checksum rather than those of the content
+func writeLyingZip(t *testing.T, content string, declaredSize uint64, declaredChecksum uint32) string {
+	compressed := new(bytes.Buffer)
+	compressor, err := flate.NewWriter(compressed, flate.BestCompression)
+	require.NoError(t, err)
+	_, err = compressor.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, compressor.Close())
+
+	buf := new(bytes.Buffer)
+	writer := zip.NewWriter(buf)
+	f, err := writer.CreateRaw(&zip.FileHeader{
+		Name:               "SRD.xlsx",
+		Method:             zip.Deflate,
+		CRC32:              declaredChecksum,
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: declaredSize,
+	})
+	require.NoError(t, err)
+	_, err = f.Write(compressed.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	path := t.TempDir() + "/archive.zip"
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0600))
+
+	return path
+}
+
+func TestExtractWorkbook_HeaderUnderstatesSize(t *testing.T) {
+	content := strings.Repeat("a", 100000)
+
+	tests := []struct {
+		name        string
+		opts        func(*ExtractOptions)
+		expectedErr error
+	}{
+		{
+			name: "compression ratio limit applies",
+			opts: func(o *ExtractOptions) {
+				o.MaxCompressionRatio = 10
+			},
+			expectedErr: ErrCompressionRatioExceeded,
+		},
+		{
+			name: "workbook size limit applies",
+			opts: func(o *ExtractOptions) {
+				o.MaxWorkbookSize = 1000
+				o.MaxCompressionRatio = 0
+			},
+			expectedErr: ErrWorkbookTooLarge,
+		},
+		{
+			name: "within the limits",
+			opts: func(o *ExtractOptions) {
+				o.MaxCompressionRatio = 0
+			},
+			expectedErr: ErrCorruptWorkbook,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+
+			// The header passes the checks, so the limits are only found on the decompressed stream
+			zipPath := writeLyingZip(t, content, 10, crc32.ChecksumIEEE([]byte(content)))
+			outDir := t.TempDir()
+
+			opts := DefaultExtractOptions()
+			tt.opts(&opts)
+
+			_, err := extractWorkbook(context.Background(), zipPath, outDir, latestDownloadBaseName, opts)
+			require.ErrorIs(err, tt.expectedErr)
+
+			files, err := os.ReadDir(outDir)
+			require.NoError(err)
+			require.Empty(files)
+		})
+	}
+}
+
+func TestExtractWorkbook_ChecksumMismatch(t *testing.T) {
+	require := require.New(t)
+	content := "xlsx content"
+
+	zipPath := writeLyingZip(t, content, uint64(len(content)), crc32.ChecksumIEEE([]byte(content))+1)
+	_, err := extractWorkbook(context.Background(), zipPath, t.TempDir(), latestDownloadBaseName, DefaultExtractOptions())
+	require.ErrorIs(err, ErrCorruptWorkbook)
+
+	// The same archive with the right checksum is extracted
+	zipPath = writeLyingZip(t, content, uint64(len(content)), crc32.ChecksumIEEE([]byte(content)))
+	path, err := extractWorkbook(context.Background(), zipPath, t.TempDir(), latestDownloadBaseName, DefaultExtractOptions())
+	require.NoError(err)
+
+	extracted, err := os.ReadFile(path)
+	require.NoError(err)
+	require.Equal(content, string(extracted))
+}
+
+func TestExtractWorkbook_MultipleWorkbooksListsEntries(t *testing.T) {
+	zipPath := writeZip(t, []zipEntry{
+		{"SRD.xlsx", "xlsx content"},
+		{"SRD_Changes.xlsx", "changes content"},
+	})
+
+	_, err := extractWorkbook(context.Background(), zipPath, t.TempDir(), latestDownloadBaseName, DefaultExtractOptions())
+	require.ErrorIs(t, err, ErrMultipleWorkbooks)
+	require.Equal(t, "multiple workbooks matching the pattern found in downloaded zip: SRD.xlsx, SRD_Changes.xlsx", err.Error())
+}
+
+func TestExtractWorkbook_InvalidArchive(t *testing.T) {
+	path := t.TempDir() + "/archive.zip"
+	require.NoError(t, os.WriteFile(path, []byte("not a zip"), 0600))
+
+	_, err := extractWorkbook(context.Background(), path, t.TempDir(), latestDownloadBaseName, DefaultExtractOptions())
+	require.ErrorIs(t, err, ErrInvalidArchive)
+	require.Equal(t, "failed to open zip file: zip: not a valid zip file", err.Error())
+}
+
+func TestExtractWorkbook_FailedExtractionKeepsPreviousDownload(t *testing.T) {
+	require := require.New(t)
+	outDir := t.TempDir()
+
+	previous := outDir + "/ukcp-srd-import-loaded-download.xlsx"
+	require.NoError(os.WriteFile(previous, []byte("previous file"), 0600))
+
+	zipPath := writeZip(t, []zipEntry{{"SRD.xlsx", "this content is too large"}})
+	opts := DefaultExtractOptions()
+	opts.MaxWorkbookSize = 5
+
+	_, err := extractWorkbook(context.Background(), zipPath, outDir, latestDownloadBaseName, opts)
+	require.ErrorIs(err, ErrWorkbookTooLarge)
+
+	content, err := os.ReadFile(previous)
+	require.NoError(err)
+	require.Equal("previous file", string(content))
+}
+
+func TestExtractWorkbook_Cancelled(t *testing.T) {
+	require := require.New(t)
+	outDir := t.TempDir()
+
+	previous := outDir + "/ukcp-srd-import-loaded-download.xlsx"
+	require.NoError(os.WriteFile(previous, []byte("previous file"), 0600))
+
+	zipPath := writeZip(t, []zipEntry{{"SRD.xlsx", "xlsx content"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := extractWorkbook(ctx, zipPath, outDir, latestDownloadBaseName, DefaultExtractOptions())
+	require.ErrorIs(err, context.Canceled)
+
+	// Only the previous download is left behind
+	entries, err := os.ReadDir(outDir)
+	require.NoError(err)
+	require.Len(entries, 1)
+
+	content, err := os.ReadFile(previous)
+	require.NoError(err)
+	require.Equal("previous file", string(content))
+}
+
+func TestDownloader_ArchiveTooLarge(t *testing.T) {
+	require := require.New(t)
+	tempDir := t.TempDir()
+
+	zipBody := createZipWithExcel("test excel content")
+	ts := &testServer{statusCode: http.StatusOK, body: zipBody}
+	ts.server = httptest.NewServer(ts)
+	defer ts.server.Close()
+
+	opts := DefaultExtractOptions()
+	opts.MaxArchiveSize = 10
+
+	cycle := airac.NewAirac(nil).CurrentCycle()
+	d, err := NewSrdDownloader(cycle, &mockLoadedAirac{ident: ""}, tempDir, ts.server.URL, WithExtractOptions(opts))
+	require.NoError(err)
+
+	err = d.Download(context.Background(), false)
+	require.ErrorIs(err, ErrArchiveTooLarge)
+}
+
+func TestDownloader_DownloadsXls(t *testing.T) {
+	require := require.New(t)
+	tempDir := t.TempDir()
+
+	zipBody := createZip([]zipEntry{{"SRD.xls", "test xls content"}})
+	ts := &testServer{statusCode: http.StatusOK, body: zipBody}
+	ts.server = httptest.NewServer(ts)
+	defer ts.server.Close()
+
+	cycle := airac.NewAirac(nil).CurrentCycle()
+	d, err := NewSrdDownloader(cycle, &mockLoadedAirac{ident: ""}, tempDir, ts.server.URL)
+	require.NoError(err)
+
+	err = d.Download(context.Background(), false)
+	require.NoError(err)
+	require.Equal(tempDir+"/ukcp-srd-import-loaded-download.xls", d.LatestFileLocation())
+
+	content, err := os.ReadFile(d.LatestFileLocation())
+	require.NoError(err)
+	require.Equal("test xls content", string(content))
+}
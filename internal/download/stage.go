@@ -0,0 +1,25 @@
+package download
+
+import (
+	"os"
+)
+
+// latestDownloadBaseName is the name, without extension, of the most recently downloaded workbook
+const latestDownloadBaseName = "ukcp-srd-import-loaded-download"
+
+// stagedBaseName is the name, without extension, of a workbook staged ahead of its cycle
+func stagedBaseName(ident string) string {
+	return "ukcp-srd-import-staged-" + ident
+}
+
+// StagedFile returns the path of the workbook staged for the cycle, if there is one
+func StagedFile(dir, ident string) (string, bool) {
+	for _, ext := range []string{".xlsx", ".xls"} {
+		path := filePath(dir, stagedBaseName(ident)+ext)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+
+	return "", false
+}
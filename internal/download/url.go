@@ -1,11 +1,57 @@
 package download
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"strconv"
+	"text/template"
 
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
 )
 
+// DefaultUrlTemplate is the pattern NATS use for the SRD archive of each cycle
+const DefaultUrlTemplate = "https://nats-uk.ead-it.com/cms-nats/export/sites/default/en/Publications/digital-datasets/SRD/AIRAC-{{.Cycle}}-{{.Year}}.zip"
+
+var ErrInvalidUrlTemplate = errors.New("invalid download URL template")
+
+// urlTemplateData is the data available to download URL templates
+type urlTemplateData struct {
+	// Ident is the full cycle identifier, e.g. 2501
+	Ident string
+
+	// Cycle is the two digit cycle number within the year, e.g. 01
+	Cycle string
+
+	// Year is the four digit year, e.g. 2025
+	Year string
+
+	// ShortYear is the two digit year, e.g. 25
+	ShortYear string
+}
+
 func DownloadUrl(airac *airac.AiracCycle) string {
-	return fmt.Sprintf("https://nats-uk.ead-it.com/cms-nats/export/sites/default/en/Publications/digital-datasets/SRD/AIRAC-%s-20%s.zip", airac.MonthString(), airac.YearString())
+	url, _ := TemplateUrl(DefaultUrlTemplate, airac)
+	return url
+}
+
+// TemplateUrl builds the download URL for a cycle from a template such as DefaultUrlTemplate
+func TemplateUrl(urlTemplate string, airac *airac.AiracCycle) (string, error) {
+	tmpl, err := template.New("url").Option("missingkey=error").Parse(urlTemplate)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidUrlTemplate, err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = tmpl.Execute(buf, urlTemplateData{
+		Ident:     airac.Ident,
+		Cycle:     airac.MonthString(),
+		Year:      strconv.Itoa(airac.Year()),
+		ShortYear: airac.YearString(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidUrlTemplate, err)
+	}
+
+	return buf.String(), nil
 }
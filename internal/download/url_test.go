@@ -3,6 +3,8 @@ package download
 import (
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
 )
 
@@ -26,6 +28,13 @@ func TestDownloadUrl(t *testing.T) {
 			},
 			expected: "https://nats-uk.ead-it.com/cms-nats/export/sites/default/en/Publications/digital-datasets/SRD/AIRAC-12-2025.zip",
 		},
+		{
+			name: "Valid AiracCycle 9901",
+			airac: &airac.AiracCycle{
+				Ident: "9901",
+			},
+			expected: "https://nats-uk.ead-it.com/cms-nats/export/sites/default/en/Publications/digital-datasets/SRD/AIRAC-01-1999.zip",
+		},
 	}
 
 	for _, tt := range tests {
@@ -37,3 +46,51 @@ func TestDownloadUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestTemplateUrl(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    string
+		ident       string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "default template",
+			template: DefaultUrlTemplate,
+			ident:    "2503",
+			expected: "https://nats-uk.ead-it.com/cms-nats/export/sites/default/en/Publications/digital-datasets/SRD/AIRAC-03-2025.zip",
+		},
+		{
+			name:     "all fields",
+			template: "https://example.com/{{.Year}}/{{.ShortYear}}/{{.Cycle}}/SRD_{{.Ident}}.zip",
+			ident:    "2613",
+			expected: "https://example.com/2026/26/13/SRD_2613.zip",
+		},
+		{
+			name:        "invalid template",
+			template:    "https://example.com/{{.Year",
+			ident:       "2613",
+			expectedErr: ErrInvalidUrlTemplate,
+		},
+		{
+			name:        "unknown field",
+			template:    "https://example.com/{{.Month}}.zip",
+			ident:       "2613",
+			expectedErr: ErrInvalidUrlTemplate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := TemplateUrl(tt.template, &airac.AiracCycle{Ident: tt.ident})
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, result)
+		})
+	}
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/route"
 )
 
+// FirstRouteRow is the row of the routes sheet that the first route is on, after the header row
+const FirstRouteRow = 2
+
 var NewRowRegxp = regexp.MustCompile(`^Note (\d+)$`)
 var ScenarioRowRegxp = regexp.MustCompile(`^Scenario S\d+`)
 
@@ -1,29 +1,277 @@
 package lock
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/alexflint/go-filemutex"
 )
 
+// lockFileName is the name of the lock file in the data directory
+const lockFileName = "ukcp-srd-import.lock"
+
+// ownerFileName is the name of the file that records who holds the lock
+const ownerFileName = "ukcp-srd-import.lock.json"
+
 type Lock struct {
 	mtx *filemutex.FileMutex
+	dir string
+
+	// The owner recorded by a process that exited without unlocking, if there was one
+	staleOwner *Owner
 }
 
 var ErrAlreadyLocked = filemutex.AlreadyLocked
 
-func NewLock() (*Lock, error) {
-	mtx, err := filemutex.New("/tmp/ukcp-srd-import.lock")
+// pollInterval is how often a waiting lock tries again
+var pollInterval = 250 * time.Millisecond
+
+// startTimeTolerance allows for the owner's start time being recorded to the second, and the boot time that process
+// start times are relative to being rounded down
+const startTimeTolerance = 2 * time.Second
+
+// clockTicksPerSecond is the unit of process start times in /proc, which is fixed at 100 on Linux
+const clockTicksPerSecond = 100
+
+// Owner describes the process holding the lock
+type Owner struct {
+	Pid      int    `json:"pid"`
+	Hostname string `json:"hostname"`
+
+	// Command is the name of the command holding the lock, such as import. The full command line isn't recorded,
+	// as its flags may include credentials.
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func (o *Owner) String() string {
+	return fmt.Sprintf("PID %d on %v (%v) since %v", o.Pid, o.Hostname, o.Command, o.StartedAt.Format(time.RFC3339))
+}
+
+// Running returns whether the owning process is still running. Processes on other hosts can't be checked,
+// so are assumed to be running. If a process with the same PID started after the owner was recorded, the PID
+// has been reused and the owner isn't running. Start times are read from /proc, so elsewhere only the PID is checked.
+func (o *Owner) Running() bool {
+	if !o.OnThisHost() {
+		return true
+	}
+
+	process, err := os.FindProcess(o.Pid)
+	if err != nil {
+		return false
+	}
+
+	// Signal 0 checks the process exists, without sending anything. EPERM means it exists but isn't ours.
+	err = process.Signal(syscall.Signal(0))
+	if err != nil && !errors.Is(err, syscall.EPERM) {
+		return false
+	}
+
+	started, ok := processStartTime(o.Pid)
+	return !ok || !started.After(o.StartedAt.Add(startTimeTolerance))
+}
+
+// OnThisHost returns whether the owner was recorded on this host, and so whether it can be checked
+func (o *Owner) OnThisHost() bool {
+	hostname, _ := os.Hostname()
+	return o.Hostname == hostname
+}
+
+// Status describes the lock for a data directory
+type Status struct {
+	// Whether the recorded owner is still running, and so holds the lock
+	Locked bool
+
+	// The owner recorded in the data directory, if there is one
+	Owner *Owner
+
+	// Whether the recorded owner is left over from a process that is no longer running
+	Stale bool
+}
+
+// NewLock takes the process lock for a data directory for a command, so installs with different directories don't
+// block each other
+func NewLock(dir string, command string) (*Lock, error) {
+	mtx, err := filemutex.New(filepath.Join(dir, lockFileName))
 	if err != nil {
 		return nil, err
 	}
 
 	err = mtx.TryLock()
 	if err != nil {
+		mtx.Close()
+		return nil, err
+	}
+
+	lock := &Lock{mtx: mtx, dir: dir}
+
+	// The file lock is released when a process dies, but the owner it recorded isn't removed
+	lock.staleOwner, _ = ReadOwner(dir)
+
+	err = writeOwner(dir, currentOwner(command))
+	if err != nil {
+		lock.Unlock()
 		return nil, err
 	}
 
-	return &Lock{mtx: mtx}, nil
+	return lock, nil
+}
+
+// WaitLock takes the process lock for a data directory, waiting up to the timeout for another process to release it.
+// If the context is cancelled while waiting, its error is returned.
+func WaitLock(ctx context.Context, dir string, command string, timeout time.Duration) (*Lock, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		lock, err := NewLock(dir, command)
+		if err != ErrAlreadyLocked {
+			return lock, err
+		}
+
+		select {
+		case <-waitCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, ErrAlreadyLocked
+		case <-ticker.C:
+		}
+	}
+}
+
+// StaleOwner returns the owner left behind by a process that exited without unlocking, if there was one when
+// the lock was taken
+func (l *Lock) StaleOwner() *Owner {
+	return l.staleOwner
 }
 
 func (l *Lock) Unlock() error {
+	err := os.Remove(filepath.Join(l.dir, ownerFileName))
+	if err != nil && !os.IsNotExist(err) {
+		l.mtx.Close()
+		return err
+	}
+
 	return l.mtx.Close()
 }
+
+// GetStatus reports whether the lock for a data directory is held, and by whom. It is worked out from the recorded
+// owner rather than by trying to take the lock, so that checking can't make a run starting at the same time fail.
+func GetStatus(dir string) (Status, error) {
+	owner, err := ReadOwner(dir)
+	if err != nil || owner == nil {
+		return Status{}, err
+	}
+
+	running := owner.Running()
+	return Status{Locked: running, Owner: owner, Stale: !running}, nil
+}
+
+// ReadOwner returns the owner recorded in a data directory, or nil if there isn't one
+func ReadOwner(dir string) (*Owner, error) {
+	content, err := os.ReadFile(filepath.Join(dir, ownerFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	owner := &Owner{}
+	err = json.Unmarshal(content, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lock owner: %w", err)
+	}
+
+	return owner, nil
+}
+
+func currentOwner(command string) *Owner {
+	hostname, _ := os.Hostname()
+
+	return &Owner{
+		Pid:       os.Getpid(),
+		Hostname:  hostname,
+		Command:   command,
+		StartedAt: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func writeOwner(dir string, owner *Owner) error {
+	content, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, ownerFileName), content, 0600)
+}
+
+// processStartTime returns when a process started, and false if that can't be found
+func processStartTime(pid int) (time.Time, bool) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// The command name is in brackets and may contain spaces, the start time is the 20th field after it
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return time.Time{}, false
+	}
+
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return time.Time{}, false
+	}
+
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	bootTime, ok := systemBootTime()
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return bootTime.Add(time.Duration(ticks) * time.Second / clockTicksPerSecond), true
+}
+
+// systemBootTime returns when the system booted, and false if that can't be found
+func systemBootTime() (time.Time, bool) {
+	stat, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	for _, line := range strings.Split(string(stat), "\n") {
+		value, found := strings.CutPrefix(line, "btime ")
+		if !found {
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		return time.Unix(seconds, 0), true
+	}
+
+	return time.Time{}, false
+}
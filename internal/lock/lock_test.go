@@ -1,13 +1,17 @@
 package lock
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestNewLock(t *testing.T) {
-	lock, err := NewLock()
+	lock, err := NewLock(t.TempDir(), "import")
 	require.NoError(t, err, "expected no error")
 	require.NotNil(t, lock, "expected lock to be non-nil")
 
@@ -17,7 +21,7 @@ func TestNewLock(t *testing.T) {
 }
 
 func TestUnlock(t *testing.T) {
-	lock, err := NewLock()
+	lock, err := NewLock(t.TempDir(), "import")
 	require.NoError(t, err, "expected no error")
 	require.NotNil(t, lock, "expected lock to be non-nil")
 
@@ -30,11 +34,12 @@ func TestUnlock(t *testing.T) {
 }
 
 func TestLockFailOnAlreadyLocked(t *testing.T) {
-	lock1, err := NewLock()
+	dir := t.TempDir()
+	lock1, err := NewLock(dir, "import")
 	require.NoError(t, err, "expected no error")
 	require.NotNil(t, lock1, "expected lock to be non-nil")
 
-	lock2, err := NewLock()
+	lock2, err := NewLock(dir, "import")
 	require.Error(t, err, "expected error on second lock")
 	require.Nil(t, lock2, "expected lock to be nil")
 
@@ -43,10 +48,163 @@ func TestLockFailOnAlreadyLocked(t *testing.T) {
 	require.NoError(t, err, "expected no error on unlock")
 
 	// If we lock again, we should be able to
-	lock3, err := NewLock()
+	lock3, err := NewLock(dir, "import")
 	require.NoError(t, err, "expected no error")
 
 	// Clean up by unlocking
 	err = lock3.Unlock()
 	require.NoError(t, err, "expected no error on unlock")
 }
+
+func TestLockDifferentDirectories(t *testing.T) {
+	lock1, err := NewLock(t.TempDir(), "import")
+	require.NoError(t, err, "expected no error")
+
+	// A different data directory has its own lock
+	lock2, err := NewLock(t.TempDir(), "import")
+	require.NoError(t, err, "expected no error")
+
+	require.NoError(t, lock1.Unlock(), "expected no error on unlock")
+	require.NoError(t, lock2.Unlock(), "expected no error on unlock")
+}
+
+func TestLockRecordsOwner(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := NewLock(dir, "import")
+	require.NoError(t, err, "expected no error")
+	require.Nil(t, lock.StaleOwner(), "expected no stale owner")
+
+	owner, err := ReadOwner(dir)
+	require.NoError(t, err, "expected no error reading owner")
+	require.NotNil(t, owner, "expected owner to be recorded")
+	require.Equal(t, os.Getpid(), owner.Pid)
+	require.Equal(t, "import", owner.Command)
+	require.True(t, owner.Running(), "expected owner to be running")
+
+	hostname, _ := os.Hostname()
+	require.Equal(t, hostname, owner.Hostname)
+
+	status, err := GetStatus(dir)
+	require.NoError(t, err, "expected no error getting status")
+	require.Equal(t, Status{Locked: true, Owner: owner, Stale: false}, status)
+
+	// Unlocking removes the owner
+	require.NoError(t, lock.Unlock(), "expected no error on unlock")
+
+	owner, err = ReadOwner(dir)
+	require.NoError(t, err, "expected no error reading owner")
+	require.Nil(t, owner, "expected owner to be removed")
+
+	status, err = GetStatus(dir)
+	require.NoError(t, err, "expected no error getting status")
+	require.Equal(t, Status{}, status)
+}
+
+func TestLockStaleOwner(t *testing.T) {
+	dir := t.TempDir()
+	hostname, _ := os.Hostname()
+
+	// A process that no longer exists left its owner behind
+	stale := &Owner{
+		Pid:       99999999,
+		Hostname:  hostname,
+		Command:   "import",
+		StartedAt: time.Date(2024, time.April, 18, 0, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, writeOwner(dir, stale))
+	require.False(t, stale.Running(), "expected stale owner not to be running")
+
+	status, err := GetStatus(dir)
+	require.NoError(t, err, "expected no error getting status")
+	require.Equal(t, Status{Locked: false, Owner: stale, Stale: true}, status)
+
+	// The next lock takes it over
+	lock, err := NewLock(dir, "import")
+	require.NoError(t, err, "expected no error")
+	require.Equal(t, stale, lock.StaleOwner())
+
+	owner, err := ReadOwner(dir)
+	require.NoError(t, err, "expected no error reading owner")
+	require.Equal(t, os.Getpid(), owner.Pid)
+
+	require.NoError(t, lock.Unlock(), "expected no error on unlock")
+}
+
+func TestGetStatusDoesNotTakeLock(t *testing.T) {
+	dir := t.TempDir()
+
+	status, err := GetStatus(dir)
+	require.NoError(t, err, "expected no error getting status")
+	require.Equal(t, Status{}, status)
+
+	// Checking the status doesn't create or take the lock, so can't get in the way of a run
+	_, err = os.Stat(filepath.Join(dir, lockFileName))
+	require.True(t, os.IsNotExist(err), "expected no lock file")
+}
+
+func TestOwnerOnAnotherHostIsAssumedRunning(t *testing.T) {
+	owner := &Owner{Pid: 99999999, Hostname: "another-host.invalid"}
+	require.True(t, owner.Running(), "expected owner on another host to be assumed running")
+}
+
+func TestOwnerWithReusedPidIsNotRunning(t *testing.T) {
+	if _, ok := processStartTime(os.Getpid()); !ok {
+		t.Skip("process start times aren't available")
+	}
+
+	// This process started after the owner was recorded, so it's a different process with the same PID
+	hostname, _ := os.Hostname()
+	owner := &Owner{
+		Pid:       os.Getpid(),
+		Hostname:  hostname,
+		Command:   "import",
+		StartedAt: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+	require.False(t, owner.Running(), "expected owner with a reused PID not to be running")
+}
+
+func TestReadOwnerInvalid(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ownerFileName), []byte("not json"), 0600))
+
+	_, err := ReadOwner(dir)
+	require.ErrorContains(t, err, "failed to parse lock owner")
+}
+
+func TestWaitLock(t *testing.T) {
+	dir := t.TempDir()
+	lock1, err := NewLock(dir, "import")
+	require.NoError(t, err, "expected no error")
+
+	// Times out while the lock is held
+	lock2, err := WaitLock(context.Background(), dir, "import", 100*time.Millisecond)
+	require.ErrorIs(t, err, ErrAlreadyLocked)
+	require.Nil(t, lock2, "expected lock to be nil")
+
+	// Succeeds once the lock is released while waiting
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		lock1.Unlock()
+	}()
+
+	lock3, err := WaitLock(context.Background(), dir, "import", 5*time.Second)
+	require.NoError(t, err, "expected no error")
+	require.NoError(t, lock3.Unlock(), "expected no error on unlock")
+}
+
+func TestWaitLockCancelled(t *testing.T) {
+	dir := t.TempDir()
+	lock1, err := NewLock(dir, "import")
+	require.NoError(t, err, "expected no error")
+	defer lock1.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	lock2, err := WaitLock(ctx, dir, "import", 5*time.Second)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Nil(t, lock2, "expected lock to be nil")
+}
@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Log formats
+const (
+	// FormatConsole is human readable, coloured when written to a terminal
+	FormatConsole = "console"
+
+	// FormatJson is one JSON object per line, for log collectors
+	FormatJson = "json"
+)
+
+// Defaults for rotating the log file
+const (
+	DefaultMaxSizeMb  = 100
+	DefaultMaxBackups = 5
+	DefaultMaxAgeDays = 28
+)
+
+var (
+	ErrInvalidFormat     = errors.New("invalid log format, must be console or json")
+	ErrCannotOpenLogFile = errors.New("failed to open log file")
+)
+
+// Options configure where logs are written and how
+type Options struct {
+	Format string
+
+	// File is where logs are written instead of stderr, if set. It is rotated once it reaches MaxSizeMb (100 if
+	// zero), keeping MaxBackups old files for up to MaxAgeDays, zero for no limit on either.
+	File       string
+	MaxSizeMb  int
+	MaxBackups int
+	MaxAgeDays int
+}
+
+// New creates a logger as configured by the options, writing to stderr if there's no log file. The closer must be
+// called once logging is finished, to close the log file.
+func New(options Options, stderr io.Writer) (zerolog.Logger, io.Closer, error) {
+	if options.Format != FormatConsole && options.Format != FormatJson {
+		return zerolog.Logger{}, nil, fmt.Errorf("%w: %q", ErrInvalidFormat, options.Format)
+	}
+
+	var out io.Writer = stderr
+	var closer io.Closer = io.NopCloser(nil)
+	if options.File != "" {
+		file, err := openFile(options)
+		if err != nil {
+			return zerolog.Logger{}, nil, err
+		}
+
+		out = file
+		closer = file
+	}
+
+	if options.Format == FormatConsole {
+		// Colours only make sense on a terminal
+		out = zerolog.ConsoleWriter{Out: out, NoColor: options.File != ""}
+	}
+
+	return zerolog.New(out).With().Timestamp().Logger(), closer, nil
+}
+
+// openFile opens the log file for appending, checking up front that it can be written so that a bad path is an
+// error now rather than lost logs later
+func openFile(options Options) (*lumberjack.Logger, error) {
+	err := os.MkdirAll(filepath.Dir(options.File), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v: %v", ErrCannotOpenLogFile, options.File, err)
+	}
+
+	file, err := os.OpenFile(options.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v: %v", ErrCannotOpenLogFile, options.File, err)
+	}
+	file.Close()
+
+	return &lumberjack.Logger{
+		Filename:   options.File,
+		MaxSize:    options.MaxSizeMb,
+		MaxBackups: options.MaxBackups,
+		MaxAge:     options.MaxAgeDays,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_Json(t *testing.T) {
+	var out bytes.Buffer
+	logger, closer, err := New(Options{Format: FormatJson}, &out)
+	require.NoError(t, err)
+	defer closer.Close()
+
+	logger.Info().Str("cycle", "2404").Int("routes", 3).Dur("duration", 1500*time.Millisecond).Msg("imported SRD for cycle 2404")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	require.Equal(t, "info", line["level"])
+	require.Equal(t, "2404", line["cycle"])
+	require.Equal(t, float64(3), line["routes"])
+	require.Equal(t, float64(1500), line["duration"])
+	require.Equal(t, "imported SRD for cycle 2404", line["message"])
+	require.Contains(t, line, "time")
+}
+
+func TestNew_Console(t *testing.T) {
+	var out bytes.Buffer
+	logger, closer, err := New(Options{Format: FormatConsole}, &out)
+	require.NoError(t, err)
+	defer closer.Close()
+
+	logger.Info().Str("cycle", "2404").Msg("imported SRD")
+	require.Contains(t, out.String(), "imported SRD")
+	require.Contains(t, out.String(), "2404")
+}
+
+func TestNew_File(t *testing.T) {
+	var out bytes.Buffer
+	path := filepath.Join(t.TempDir(), "logs", "srd.log")
+
+	logger, closer, err := New(Options{Format: FormatConsole, File: path, MaxSizeMb: 1}, &out)
+	require.NoError(t, err)
+
+	logger.Info().Msg("imported SRD")
+	require.NoError(t, closer.Close())
+
+	// Nothing is written to stderr, and the file has no colour codes
+	require.Empty(t, out.String())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(content), "INF imported SRD")
+	require.NotContains(t, string(content), "\x1b[")
+}
+
+func TestNew_Errors(t *testing.T) {
+	_, _, err := New(Options{Format: "xml"}, &bytes.Buffer{})
+	require.ErrorIs(t, err, ErrInvalidFormat)
+
+	// The log file's directory is a file
+	parent := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(parent, nil, 0600))
+
+	_, _, err = New(Options{Format: FormatJson, File: filepath.Join(parent, "srd.log")}, &bytes.Buffer{})
+	require.ErrorIs(t, err, ErrCannotOpenLogFile)
+}
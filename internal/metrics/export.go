@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TextfileName returns the name of the file written for the node_exporter textfile collector by a command, each
+// command has its own so that running one doesn't replace the metrics of another
+func TextfileName(command string) string {
+	return "ukcp_srd_tools_" + command + ".prom"
+}
+
+// Job is the job the metrics are pushed to a Pushgateway as
+const Job = "ukcp_srd_tools"
+
+var (
+	ErrCannotWriteTextfile = errors.New("failed to write metrics textfile")
+	ErrPushFailed          = errors.New("failed to push metrics")
+)
+
+// WriteTextfile writes the metrics of a command to its file in the directory read by the node_exporter textfile
+// collector. Every sample is labelled with the command, so that the files of different commands don't collide. The
+// file is written in full and then renamed into place, so that a partly written file is never collected.
+func WriteTextfile(registry *Registry, dir string, command string) error {
+	var content bytes.Buffer
+	err := registry.write(&content, Labels{"command": command})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCannotWriteTextfile, err)
+	}
+
+	// The collector only reads files ending in .prom, so the temporary file is ignored
+	tempFile, err := os.CreateTemp(dir, TextfileName(command)+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCannotWriteTextfile, err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(content.Bytes())
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	// Temporary files are private, but the collector may run as another user
+	if err == nil {
+		err = os.Chmod(tempFile.Name(), 0644)
+	}
+
+	if err == nil {
+		err = os.Rename(tempFile.Name(), filepath.Join(dir, TextfileName(command)))
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCannotWriteTextfile, err)
+	}
+
+	return nil
+}
+
+// Push replaces the metrics in a Pushgateway's group for the job and grouping labels, such as the command
+func Push(ctx context.Context, client *http.Client, registry *Registry, gatewayUrl string, grouping Labels) error {
+	pushUrl := strings.TrimRight(gatewayUrl, "/") + "/metrics/job/" + url.PathEscape(Job)
+	for _, name := range sortedKeys(grouping) {
+		pushUrl += "/" + url.PathEscape(name) + "/" + url.PathEscape(grouping[name])
+	}
+
+	var content bytes.Buffer
+	err := registry.Write(&content)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPushFailed, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, pushUrl, &content)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPushFailed, err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPushFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %v returned %v", ErrPushFailed, pushUrl, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Namespace prefixes the name of every metric
+const Namespace = "ukcp_srd"
+
+// ContentType is the Prometheus text exposition format that metrics are written in
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Labels distinguish the samples of a metric
+type Labels map[string]string
+
+// Registry holds the current value of a set of gauges, which can be written out in the Prometheus text format.
+// It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// family is a metric and its samples, keyed by their rendered labels
+type family struct {
+	help    string
+	samples map[string]sample
+}
+
+type sample struct {
+	labels Labels
+	value  float64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Set sets the value of the metric with the labels, the name is prefixed with the namespace
+func (r *Registry) Set(name string, help string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name = Namespace + "_" + name
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{help: help, samples: make(map[string]sample)}
+		r.families[name] = f
+	}
+
+	f.samples[renderLabels(labels)] = sample{labels: labels, value: value}
+}
+
+// Write writes every metric in the Prometheus text format, sorted so that the output is stable
+func (r *Registry) Write(w io.Writer) error {
+	return r.write(w, nil)
+}
+
+// write writes every metric with the extra labels added to each sample, as a Pushgateway adds its grouping labels
+func (r *Registry) write(w io.Writer, extra Labels) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	for _, name := range sortedKeys(r.families) {
+		f := r.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, escapeHelp(f.help))
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+
+		lines := make(map[string]float64, len(f.samples))
+		for _, sample := range f.samples {
+			lines[renderLabels(mergeLabels(sample.labels, extra))] = sample.value
+		}
+
+		for _, labels := range sortedKeys(lines) {
+			fmt.Fprintf(&b, "%s%s %s\n", name, labels, formatValue(lines[labels]))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the metrics, so that the registry can be scraped on /metrics by a long running process
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = r.Write(w)
+}
+
+// renderLabels renders labels as they appear after the metric name, sorted by name
+func renderLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for _, name := range sortedKeys(labels) {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabel(labels[name])))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// mergeLabels returns the labels with the extra labels added
+func mergeLabels(labels Labels, extra Labels) Labels {
+	if len(extra) == 0 {
+		return labels
+	}
+
+	merged := make(Labels, len(labels)+len(extra))
+	for name, value := range labels {
+		merged[name] = value
+	}
+
+	for name, value := range extra {
+		merged[name] = value
+	}
+
+	return merged
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/progress"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	registry := NewRegistry()
+	registry.Set("last_run_success", "Whether the last run succeeded.", Labels{"command": "import"}, 1)
+	registry.Set("last_run_success", "Whether the last run succeeded.", Labels{"command": "download"}, 0)
+	registry.Set("download_bytes", "Bytes downloaded.", nil, 1234567)
+	registry.Set("loaded_cycle_info", "The loaded cycle.", Labels{"cycle": `26"01\`}, 1)
+
+	// Setting a sample again replaces it
+	registry.Set("download_bytes", "Bytes downloaded.", nil, 2345678)
+
+	var out strings.Builder
+	require.NoError(t, registry.Write(&out))
+	require.Equal(t, `# HELP ukcp_srd_download_bytes Bytes downloaded.
+# TYPE ukcp_srd_download_bytes gauge
+ukcp_srd_download_bytes 2.345678e+06
+# HELP ukcp_srd_last_run_success Whether the last run succeeded.
+# TYPE ukcp_srd_last_run_success gauge
+ukcp_srd_last_run_success{command="download"} 0
+ukcp_srd_last_run_success{command="import"} 1
+# HELP ukcp_srd_loaded_cycle_info The loaded cycle.
+# TYPE ukcp_srd_loaded_cycle_info gauge
+ukcp_srd_loaded_cycle_info{cycle="26\"01\\"} 1
+`, out.String())
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	registry.Set("download_bytes", "Bytes downloaded.", nil, 10)
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, ContentType, recorder.Header().Get("Content-Type"))
+	require.Contains(t, recorder.Body.String(), "ukcp_srd_download_bytes 10\n")
+}
+
+func TestRecorder(t *testing.T) {
+	now := time.Date(2026, 1, 22, 3, 0, 0, 0, time.UTC)
+	registry := NewRegistry()
+	recorder := newRecorder(registry, func() time.Time { return now })
+
+	var passedOn []progress.Event
+	reporter := recorder.Reporter(func(e progress.Event) { passedOn = append(passedOn, e) })
+
+	events := []progress.Event{
+		{Stage: progress.StageDownload, Current: 0, Total: 2048},
+		{Stage: progress.StageDownload, Current: 2048, Total: 2048, Done: true},
+		{Stage: progress.StageRoutes, Current: 500, BatchSize: 500, BatchDuration: 2 * time.Second},
+		{Stage: progress.StageRoutes, Current: 800, BatchSize: 300, BatchDuration: time.Second, Done: true},
+	}
+
+	for _, e := range events {
+		reporter(e)
+		now = now.Add(3 * time.Second)
+	}
+
+	require.Equal(t, events, passedOn)
+
+	started := now.Add(-time.Minute)
+	recorder.ParseErrors(4, 1)
+	recorder.LoadedCycle("2601", time.Date(2026, 1, 22, 2, 0, 0, 0, time.UTC))
+	recorder.Finished("download", started, true)
+
+	var out strings.Builder
+	require.NoError(t, registry.Write(&out))
+
+	for _, line := range []string{
+		"ukcp_srd_download_bytes 2048\n",
+		`ukcp_srd_stage_duration_seconds{stage="download"} 3` + "\n",
+		// The first batch of routes took 2 seconds before its event, then 3 seconds until the last event
+		`ukcp_srd_stage_duration_seconds{stage="routes"} 5` + "\n",
+		`ukcp_srd_rows_inserted{stage="routes"} 800` + "\n",
+		`ukcp_srd_parse_errors{kind="routes"} 4` + "\n",
+		`ukcp_srd_parse_errors{kind="notes"} 1` + "\n",
+		`ukcp_srd_loaded_cycle_info{cycle="2601"} 1` + "\n",
+		"ukcp_srd_loaded_cycle_timestamp_seconds 1.7690472e+09\n",
+		`ukcp_srd_last_run_success{command="download"} 1` + "\n",
+		`ukcp_srd_last_run_duration_seconds{command="download"} 60` + "\n",
+	} {
+		require.Contains(t, out.String(), line)
+	}
+
+	// Downloads aren't counted as rows
+	require.NotContains(t, out.String(), `ukcp_srd_rows_inserted{stage="download"}`)
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir := t.TempDir()
+	registry := NewRegistry()
+	registry.Set("download_bytes", "Bytes downloaded.", nil, 10)
+	registry.Set("stage_duration_seconds", "Stage duration.", Labels{"stage": "download"}, 2)
+
+	require.NoError(t, WriteTextfile(registry, dir, "download"))
+
+	// Every sample is labelled with the command
+	content, err := os.ReadFile(filepath.Join(dir, "ukcp_srd_tools_download.prom"))
+	require.NoError(t, err)
+	require.Contains(t, string(content), `ukcp_srd_download_bytes{command="download"} 10`+"\n")
+	require.Contains(t, string(content), `ukcp_srd_stage_duration_seconds{command="download",stage="download"} 2`+"\n")
+
+	// The registry itself is unchanged
+	var out strings.Builder
+	require.NoError(t, registry.Write(&out))
+	require.Contains(t, out.String(), "ukcp_srd_download_bytes 10\n")
+
+	info, err := os.Stat(filepath.Join(dir, TextfileName("download")))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// Another command has its own file, leaving the first in place
+	require.NoError(t, WriteTextfile(NewRegistry(), dir, "import"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.Equal(t, []string{"ukcp_srd_tools_download.prom", "ukcp_srd_tools_import.prom"}, names)
+
+	require.ErrorIs(t, WriteTextfile(registry, filepath.Join(dir, "missing"), "download"), ErrCannotWriteTextfile)
+}
+
+func TestPush(t *testing.T) {
+	registry := NewRegistry()
+	registry.Set("download_bytes", "Bytes downloaded.", nil, 10)
+
+	var method, path, contentType, body string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType = r.Method, r.URL.Path, r.Header.Get("Content-Type")
+		content, _ := io.ReadAll(r.Body)
+		body = string(content)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	err := Push(context.Background(), server.Client(), registry, server.URL+"/", Labels{"command": "download"})
+	require.NoError(t, err)
+	require.Equal(t, http.MethodPut, method)
+	require.Equal(t, "/metrics/job/ukcp_srd_tools/command/download", path)
+	require.Equal(t, ContentType, contentType)
+	require.Contains(t, body, "ukcp_srd_download_bytes 10\n")
+
+	status = http.StatusBadRequest
+	err = Push(context.Background(), server.Client(), registry, server.URL, nil)
+	require.ErrorIs(t, err, ErrPushFailed)
+	require.ErrorContains(t, err, "400 Bad Request")
+}
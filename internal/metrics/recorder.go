@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/progress"
+)
+
+// Recorder records the metrics of a run of a command into a registry
+type Recorder struct {
+	registry *Registry
+	now      func() time.Time
+
+	// When each stage started, to time them
+	stageStarts map[progress.Stage]time.Time
+}
+
+func NewRecorder(registry *Registry) *Recorder {
+	return newRecorder(registry, time.Now)
+}
+
+func newRecorder(registry *Registry, now func() time.Time) *Recorder {
+	return &Recorder{registry: registry, now: now, stageStarts: make(map[progress.Stage]time.Time)}
+}
+
+// Registry returns the registry the metrics are recorded in
+func (r *Recorder) Registry() *Registry {
+	return r.registry
+}
+
+// Reporter returns a progress reporter that records the duration and size of each stage, before passing the event on
+func (r *Recorder) Reporter(next progress.Reporter) progress.Reporter {
+	return func(e progress.Event) {
+		r.recordEvent(e)
+		next(e)
+	}
+}
+
+func (r *Recorder) recordEvent(e progress.Event) {
+	labels := Labels{"stage": string(e.Stage)}
+
+	// A stage starts when its first batch started, the time taken to insert it is in the event
+	start, ok := r.stageStarts[e.Stage]
+	if !ok {
+		start = r.now().Add(-e.BatchDuration)
+		r.stageStarts[e.Stage] = start
+	}
+
+	r.registry.Set("stage_duration_seconds", "How long each stage of the last run took.", labels, r.now().Sub(start).Seconds())
+
+	if e.Stage == progress.StageDownload {
+		r.registry.Set("download_bytes", "Size of the SRD archive downloaded by the last run.", nil, float64(e.Current))
+		return
+	}
+
+	r.registry.Set("rows_inserted", "Rows inserted by each stage of the last import.", labels, float64(e.Current))
+}
+
+// ParseErrors records how many rows of the SRD file couldn't be parsed
+func (r *Recorder) ParseErrors(routeErrors int, noteErrors int) {
+	help := "Rows of the SRD file imported by the last run that couldn't be parsed."
+	r.registry.Set("parse_errors", help, Labels{"kind": "routes"}, float64(routeErrors))
+	r.registry.Set("parse_errors", help, Labels{"kind": "notes"}, float64(noteErrors))
+}
+
+// LoadedCycle records the AIRAC cycle that has been loaded, and when it was imported
+func (r *Recorder) LoadedCycle(ident string, importedAt time.Time) {
+	r.registry.Set("loaded_cycle_info", "The AIRAC cycle loaded by the last run, always 1.", Labels{"cycle": ident}, 1)
+	r.registry.Set("loaded_cycle_timestamp_seconds", "When the loaded AIRAC cycle was imported.", nil, float64(importedAt.Unix()))
+}
+
+// Finished records the outcome of the run of a command, which started at the time given
+func (r *Recorder) Finished(command string, started time.Time, success bool) {
+	labels := Labels{"command": command}
+	value := 0.0
+	if success {
+		value = 1
+	}
+
+	finished := r.now()
+	r.registry.Set("last_run_success", "Whether the last run of the command succeeded.", labels, value)
+	r.registry.Set("last_run_timestamp_seconds", "When the last run of the command finished.", labels, float64(finished.Unix()))
+	r.registry.Set("last_run_duration_seconds", "How long the last run of the command took.", labels, finished.Sub(started).Seconds())
+}
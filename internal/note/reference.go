@@ -0,0 +1,40 @@
+package note
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrDanglingReferences = errors.New("routes refer to notes that are missing from the file")
+
+// DanglingReference is a reference from a route to a note that isn't in the file, usually because the note
+// couldn't be parsed. The route loses the restrictions in the note.
+type DanglingReference struct {
+	// Row is the row of the route in the routes sheet
+	Row         int
+	Origin      string
+	Destination string
+	NoteID      uint64
+}
+
+func (r DanglingReference) String() string {
+	return fmt.Sprintf("route on row %d (%v to %v) refers to missing note %d", r.Row, r.Origin, r.Destination, r.NoteID)
+}
+
+// DanglingReferencesError is returned when routes refer to missing notes and that isn't allowed
+type DanglingReferencesError struct {
+	References []DanglingReference
+}
+
+func (e *DanglingReferencesError) Error() string {
+	first := e.References[0]
+	if len(e.References) == 1 {
+		return fmt.Sprintf("%v: %v", ErrDanglingReferences, first)
+	}
+
+	return fmt.Sprintf("%v: %v, and %d more", ErrDanglingReferences, first, len(e.References)-1)
+}
+
+func (e *DanglingReferencesError) Unwrap() error {
+	return ErrDanglingReferences
+}
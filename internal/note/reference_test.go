@@ -0,0 +1,18 @@
+package note
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDanglingReferencesError(t *testing.T) {
+	reference := DanglingReference{Row: 12, Origin: "EGLL", Destination: "EGKK", NoteID: 7}
+
+	err := &DanglingReferencesError{References: []DanglingReference{reference}}
+	require.ErrorIs(t, err, ErrDanglingReferences)
+	require.Equal(t, "routes refer to notes that are missing from the file: route on row 12 (EGLL to EGKK) refers to missing note 7", err.Error())
+
+	err = &DanglingReferencesError{References: []DanglingReference{reference, reference, reference}}
+	require.Equal(t, "routes refer to notes that are missing from the file: route on row 12 (EGLL to EGKK) refers to missing note 7, and 2 more", err.Error())
+}
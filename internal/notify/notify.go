@@ -0,0 +1,212 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Event is what happened, targets choose which events they are sent
+type Event string
+
+const (
+	// EventSuccess is an import that was committed, of the cycle that was already loaded
+	EventSuccess Event = "success"
+
+	// EventFailure is a download or import that failed
+	EventFailure Event = "failure"
+
+	// EventChangeover is an import that was committed and changed the loaded cycle
+	EventChangeover Event = "changeover"
+)
+
+// Events are every event, in the order they are listed
+var Events = []Event{EventSuccess, EventFailure, EventChangeover}
+
+// Format is the payload a target is sent
+type Format string
+
+const (
+	// FormatWebhook is a JSON object of the notification's details, for generic webhooks
+	FormatWebhook Format = "webhook"
+
+	// FormatDiscord is a message with an embed, for Discord and compatible webhooks
+	FormatDiscord Format = "discord"
+)
+
+var (
+	ErrUnknownEvent  = errors.New("unknown notification event")
+	ErrUnknownFormat = errors.New("unknown notification format")
+	ErrSendFailed    = errors.New("failed to send notification")
+)
+
+// Stages a notification can be about
+const (
+	StageDownload = "download"
+	StageImport   = "import"
+)
+
+// Notification describes the outcome of a download or import
+type Notification struct {
+	Event Event
+
+	// Stage is the part of the process the notification is about, download or import
+	Stage string
+
+	// Cycle is the AIRAC cycle being downloaded or imported, and PreviousCycle the one loaded before it
+	Cycle         string
+	PreviousCycle string
+
+	// The rows imported, and how many rows of the file were invalid
+	Routes      int
+	RouteErrors int
+	Notes       int
+	NoteErrors  int
+
+	// The rows of the previously loaded cycle, zero if they aren't known
+	PreviousRoutes int
+	PreviousNotes  int
+
+	// Error is why the download or import failed
+	Error string
+
+	Time time.Time
+}
+
+// Summary describes the notification in a line
+func (n Notification) Summary() string {
+	switch {
+	case n.Event == EventFailure && n.Cycle == "":
+		return fmt.Sprintf("SRD %v failed", n.Stage)
+	case n.Event == EventFailure:
+		return fmt.Sprintf("SRD %v for AIRAC cycle %v failed", n.Stage, n.Cycle)
+	case n.Event == EventChangeover && n.PreviousCycle != "":
+		return fmt.Sprintf("AIRAC cycle changed from %v to %v", n.PreviousCycle, n.Cycle)
+	case n.Event == EventChangeover:
+		return fmt.Sprintf("Loaded SRD for AIRAC cycle %v", n.Cycle)
+	}
+
+	return fmt.Sprintf("Imported SRD for AIRAC cycle %v", n.Cycle)
+}
+
+// Diff summarises how the number of rows changed from the previously loaded cycle, empty if that isn't known
+func (n Notification) Diff() string {
+	if n.Event == EventFailure || (n.PreviousRoutes == 0 && n.PreviousNotes == 0) {
+		return ""
+	}
+
+	return fmt.Sprintf("routes %v to %v (%+d), notes %v to %v (%+d)", n.PreviousRoutes, n.Routes, n.Routes-n.PreviousRoutes, n.PreviousNotes, n.Notes, n.Notes-n.PreviousNotes)
+}
+
+// Target is somewhere notifications are sent
+type Target struct {
+	Format Format
+	Url    string
+
+	// Events are the events the target is sent, all of them if empty
+	Events []Event
+}
+
+// Wants reports whether the target is sent the event
+func (t Target) Wants(event Event) bool {
+	if len(t.Events) == 0 {
+		return true
+	}
+
+	for _, e := range t.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseEvents parses a comma separated list of events, such as "failure, changeover"
+func ParseEvents(list string) ([]Event, error) {
+	events := make([]Event, 0)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		event := Event(name)
+		if event != EventSuccess && event != EventFailure && event != EventChangeover {
+			return nil, fmt.Errorf("%w %q, must be one of %v", ErrUnknownEvent, name, Events)
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// Notifier sends notifications to the targets that want them
+type Notifier struct {
+	client  *http.Client
+	targets []Target
+}
+
+func NewNotifier(client *http.Client, targets ...Target) *Notifier {
+	return &Notifier{client: client, targets: targets}
+}
+
+// Notify sends the notification to every target that wants it. A target that fails doesn't stop the others being
+// sent it, the errors are all returned.
+func (n *Notifier) Notify(ctx context.Context, notification Notification) error {
+	errs := make([]error, 0)
+	for _, target := range n.targets {
+		if !target.Wants(notification.Event) {
+			continue
+		}
+
+		if err := n.send(ctx, target, notification); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// send posts the notification to a target. Webhook URLs often contain a token, so only the host is given in errors.
+func (n *Notifier) send(ctx context.Context, target Target, notification Notification) error {
+	host := target.Url
+	if parsed, err := url.Parse(target.Url); err == nil {
+		host = parsed.Host
+	}
+
+	payload, err := encode(target.Format, notification)
+	if err != nil {
+		return fmt.Errorf("%w to %v: %w", ErrSendFailed, host, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%w to %v: invalid URL", ErrSendFailed, host)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The client's errors include the URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return fmt.Errorf("%w to %v: %v", ErrSendFailed, host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w to %v: %v", ErrSendFailed, host, resp.Status)
+	}
+
+	return nil
+}
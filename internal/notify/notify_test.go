@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// receiver is a webhook that records what it's sent
+type receiver struct {
+	server   *httptest.Server
+	status   int
+	received []map[string]any
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{status: http.StatusNoContent}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, http.MethodPost, req.Method)
+		require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		var payload map[string]any
+		require.NoError(t, json.Unmarshal(body, &payload))
+		r.received = append(r.received, payload)
+
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+var changeover = Notification{
+	Event:          EventChangeover,
+	Stage:          StageImport,
+	Cycle:          "2601",
+	PreviousCycle:  "2513",
+	Routes:         168000,
+	RouteErrors:    12,
+	Notes:          905,
+	PreviousRoutes: 170000,
+	PreviousNotes:  900,
+	Time:           time.Date(2026, 1, 22, 3, 0, 0, 0, time.UTC),
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	r := newReceiver(t)
+
+	notifier := NewNotifier(r.server.Client(), Target{Format: FormatWebhook, Url: r.server.URL})
+	require.NoError(t, notifier.Notify(context.Background(), changeover))
+
+	require.Equal(t, []map[string]any{{
+		"event":          "changeover",
+		"stage":          "import",
+		"summary":        "AIRAC cycle changed from 2513 to 2601",
+		"cycle":          "2601",
+		"previous_cycle": "2513",
+		"routes":         float64(168000),
+		"route_errors":   float64(12),
+		"notes":          float64(905),
+		"note_errors":    float64(0),
+		"diff":           "routes 170000 to 168000 (-2000), notes 900 to 905 (+5)",
+		"time":           "2026-01-22T03:00:00Z",
+	}}, r.received)
+}
+
+func TestNotifyDiscord(t *testing.T) {
+	r := newReceiver(t)
+	notifier := NewNotifier(r.server.Client(), Target{Format: FormatDiscord, Url: r.server.URL})
+
+	require.NoError(t, notifier.Notify(context.Background(), changeover))
+	require.Equal(t, map[string]any{
+		"username": "UKCP SRD Tools",
+		"embeds": []any{map[string]any{
+			"title":       "AIRAC cycle changed from 2513 to 2601",
+			"description": "routes 170000 to 168000 (-2000), notes 900 to 905 (+5)",
+			"color":       float64(0x3498db),
+			"timestamp":   "2026-01-22T03:00:00Z",
+			"fields": []any{
+				map[string]any{"name": "Cycle", "value": "2601", "inline": true},
+				map[string]any{"name": "Routes", "value": "168000 (12 invalid)", "inline": true},
+				map[string]any{"name": "Notes", "value": "905 (0 invalid)", "inline": true},
+			},
+		}},
+	}, r.received[0])
+
+	// Failures show the error, shortened if it's long
+	failure := Notification{Event: EventFailure, Stage: StageDownload, Cycle: "2601", Error: strings.Repeat("x", 2000), Time: changeover.Time}
+	require.NoError(t, notifier.Notify(context.Background(), failure))
+
+	embed := r.received[1]["embeds"].([]any)[0].(map[string]any)
+	require.Equal(t, "SRD download for AIRAC cycle 2601 failed", embed["title"])
+	require.Equal(t, float64(0xe74c3c), embed["color"])
+	require.Equal(t, "```\n"+strings.Repeat("x", 999)+"…\n```", embed["description"])
+	require.NotContains(t, embed, "fields")
+}
+
+func TestNotifyEvents(t *testing.T) {
+	failures := newReceiver(t)
+	everything := newReceiver(t)
+
+	notifier := NewNotifier(http.DefaultClient,
+		Target{Format: FormatWebhook, Url: failures.server.URL, Events: []Event{EventFailure}},
+		Target{Format: FormatWebhook, Url: everything.server.URL},
+	)
+
+	require.NoError(t, notifier.Notify(context.Background(), changeover))
+	require.NoError(t, notifier.Notify(context.Background(), Notification{Event: EventFailure, Stage: StageImport, Error: "failed"}))
+
+	require.Len(t, failures.received, 1)
+	require.Equal(t, "failure", failures.received[0]["event"])
+	require.Len(t, everything.received, 2)
+}
+
+func TestNotifyErrors(t *testing.T) {
+	failing := newReceiver(t)
+	failing.status = http.StatusInternalServerError
+	working := newReceiver(t)
+
+	notifier := NewNotifier(http.DefaultClient,
+		Target{Format: FormatDiscord, Url: failing.server.URL + "/api/webhooks/123/secret-token"},
+		Target{Format: FormatWebhook, Url: working.server.URL},
+	)
+
+	// The working target is still sent the notification, and the token isn't in the error
+	err := notifier.Notify(context.Background(), changeover)
+	require.ErrorIs(t, err, ErrSendFailed)
+	require.ErrorContains(t, err, "500 Internal Server Error")
+	require.NotContains(t, err.Error(), "secret-token")
+	require.Len(t, working.received, 1)
+
+	notifier = NewNotifier(http.DefaultClient, Target{Format: "email", Url: working.server.URL})
+	err = notifier.Notify(context.Background(), changeover)
+	require.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestParseEvents(t *testing.T) {
+	events, err := ParseEvents("failure, changeover")
+	require.NoError(t, err)
+	require.Equal(t, []Event{EventFailure, EventChangeover}, events)
+
+	events, err = ParseEvents("")
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	_, err = ParseEvents("failure,started")
+	require.ErrorIs(t, err, ErrUnknownEvent)
+}
+
+func TestSummaryAndDiff(t *testing.T) {
+	tests := []struct {
+		name            string
+		notification    Notification
+		expectedSummary string
+		expectedDiff    string
+	}{
+		{
+			name:            "reimport",
+			notification:    Notification{Event: EventSuccess, Cycle: "2601", Routes: 10, Notes: 2, PreviousRoutes: 8, PreviousNotes: 2},
+			expectedSummary: "Imported SRD for AIRAC cycle 2601",
+			expectedDiff:    "routes 8 to 10 (+2), notes 2 to 2 (+0)",
+		},
+		{
+			name:            "first import",
+			notification:    Notification{Event: EventChangeover, Cycle: "2601", Routes: 10, Notes: 2},
+			expectedSummary: "Loaded SRD for AIRAC cycle 2601",
+		},
+		{
+			name:            "failure without a cycle",
+			notification:    Notification{Event: EventFailure, Stage: StageImport, Error: "invalid cycle"},
+			expectedSummary: "SRD import failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expectedSummary, tt.notification.Summary())
+			require.Equal(t, tt.expectedDiff, tt.notification.Diff())
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// username is who Discord messages are posted as
+const username = "UKCP SRD Tools"
+
+// maxErrorLength is how much of an error is included in a Discord message, well within the limit on embeds
+const maxErrorLength = 1000
+
+// Discord embed colours
+const (
+	colourSuccess    = 0x2ecc71
+	colourFailure    = 0xe74c3c
+	colourChangeover = 0x3498db
+)
+
+// webhookPayload is the JSON sent to generic webhooks
+type webhookPayload struct {
+	Event         Event     `json:"event"`
+	Stage         string    `json:"stage"`
+	Summary       string    `json:"summary"`
+	Cycle         string    `json:"cycle,omitempty"`
+	PreviousCycle string    `json:"previous_cycle,omitempty"`
+	Routes        int       `json:"routes"`
+	RouteErrors   int       `json:"route_errors"`
+	Notes         int       `json:"notes"`
+	NoteErrors    int       `json:"note_errors"`
+	Diff          string    `json:"diff,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// discordPayload is a Discord webhook message, see https://discord.com/developers/docs/resources/webhook
+type discordPayload struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// encode returns the payload of the notification in the format
+func encode(format Format, n Notification) ([]byte, error) {
+	switch format {
+	case FormatWebhook:
+		return json.Marshal(webhookPayload{
+			Event:         n.Event,
+			Stage:         n.Stage,
+			Summary:       n.Summary(),
+			Cycle:         n.Cycle,
+			PreviousCycle: n.PreviousCycle,
+			Routes:        n.Routes,
+			RouteErrors:   n.RouteErrors,
+			Notes:         n.Notes,
+			NoteErrors:    n.NoteErrors,
+			Diff:          n.Diff(),
+			Error:         n.Error,
+			Time:          n.Time,
+		})
+	case FormatDiscord:
+		return json.Marshal(discordPayload{Username: username, Embeds: []discordEmbed{discordMessage(n)}})
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+}
+
+// discordMessage describes the notification as an embed, the error for failures and the counts otherwise
+func discordMessage(n Notification) discordEmbed {
+	embed := discordEmbed{Title: n.Summary(), Timestamp: n.Time.UTC().Format(time.RFC3339)}
+
+	if n.Event == EventFailure {
+		embed.Color = colourFailure
+		embed.Description = "```\n" + truncate(n.Error, maxErrorLength) + "\n```"
+		return embed
+	}
+
+	embed.Color = colourSuccess
+	if n.Event == EventChangeover {
+		embed.Color = colourChangeover
+	}
+
+	embed.Description = n.Diff()
+	embed.Fields = []discordField{
+		{Name: "Cycle", Value: n.Cycle, Inline: true},
+		{Name: "Routes", Value: fmt.Sprintf("%v (%v invalid)", n.Routes, n.RouteErrors), Inline: true},
+		{Name: "Notes", Value: fmt.Sprintf("%v (%v invalid)", n.Notes, n.NoteErrors), Inline: true},
+	}
+
+	return embed
+}
+
+// truncate shortens text to at most max runes, marking that it has been shortened
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+
+	return string(runes[:max-1]) + "…"
+}
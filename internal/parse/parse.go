@@ -16,19 +16,38 @@ type srdFile interface {
 	Stats() file.SrdStats
 }
 
-// ParseSrd parses the SRD file and returns a summary of the parsing
-func ParseSrd(file srdFile) file.SrdStats {
-	for _, err := range file.Routes() {
+// ParseSrd parses the SRD file and returns a summary of the parsing, along with any references from routes to
+// notes that are missing from the file
+func ParseSrd(srd srdFile) (file.SrdStats, []note.DanglingReference) {
+	noteIDs := make(map[uint64]bool)
+	for srdNote, err := range srd.Notes() {
 		if err != nil {
-			log.Error().Msgf("Error parsing route: %v", err)
+			log.Error().Msgf("Error parsing note: %v", err)
+			continue
 		}
+
+		noteIDs[srdNote.ID()] = true
 	}
 
-	for _, err := range file.Notes() {
+	dangling := make([]note.DanglingReference, 0)
+	row := file.FirstRouteRow
+	for srdRoute, err := range srd.Routes() {
 		if err != nil {
-			log.Error().Msgf("Error parsing note: %v", err)
+			log.Error().Msgf("Error parsing route: %v", err)
+		} else {
+			for _, noteID := range srdRoute.NoteIDs() {
+				if noteIDs[noteID] {
+					continue
+				}
+
+				reference := note.DanglingReference{Row: row, Origin: srdRoute.ADEPOrEntry(), Destination: srdRoute.ADESOrExit(), NoteID: noteID}
+				log.Warn().Msgf("Dangling note reference: %v", reference)
+				dangling = append(dangling, reference)
+			}
 		}
+
+		row++
 	}
 
-	return file.Stats()
+	return srd.Stats(), dangling
 }
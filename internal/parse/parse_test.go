@@ -77,13 +77,54 @@ func TestParse(t *testing.T) {
 	}
 
 	// Parse the SRD file
-	summary := ParseSrd(mockSrdFile)
+	summary, dangling := ParseSrd(mockSrdFile)
 
 	// Check the summary
 	require.Equal(3, summary.RouteCount)
 	require.Equal(2, summary.RouteErrorCount)
 	require.Equal(4, summary.NoteCount)
 	require.Equal(3, summary.NoteErrorCount)
+	require.Empty(dangling)
+}
+
+func TestParse_DanglingReferences(t *testing.T) {
+	require := require.New(t)
+
+	// Create a fake SRD file, where note 2 couldn't be parsed and note 5 doesn't exist
+	mockSrdFile := &mockSrdFile{
+		notes: srdNoteList{
+			{
+				note: note.NewNote(1, "Note 1 Text"),
+				err:  nil,
+			},
+			{
+				note: nil,
+				err:  errors.New("foo"),
+			},
+		},
+		routes: srdRouteList{
+			{
+				route: route.NewRoute("EGLL", ptr("SID1"), ptr(uint64(35000)), ptr(uint64(37000)), "SEGMENT", ptr("STAR1"), "EGKK", []uint64{1, 2}),
+				err:   nil,
+			},
+			{
+				route: nil,
+				err:   errors.New("foo"),
+			},
+			{
+				route: route.NewRoute("EGGD", nil, ptr(uint64(37000)), ptr(uint64(39000)), "SEGMENT", nil, "EGLL", []uint64{5}),
+				err:   nil,
+			},
+		},
+	}
+
+	_, dangling := ParseSrd(mockSrdFile)
+
+	// Rows are counted from the header row, including routes that couldn't be parsed
+	require.Equal([]note.DanglingReference{
+		{Row: 2, Origin: "EGLL", Destination: "EGKK", NoteID: 2},
+		{Row: 4, Origin: "EGGD", Destination: "EGLL", NoteID: 5},
+	}, dangling)
 }
 
 // Do a benchmark of the Parse function
@@ -0,0 +1,48 @@
+package progress
+
+import (
+	"time"
+)
+
+// Stage identifies the part of the process an event relates to
+type Stage string
+
+const (
+	StageDownload Stage = "download"
+	StageNotes    Stage = "notes"
+	StageRoutes   Stage = "routes"
+	StageLinks    Stage = "links"
+)
+
+// Event is a progress update for a stage of a download or import
+type Event struct {
+	Stage Stage
+
+	// Current is how far through the stage we are, in bytes for downloads and rows for imports
+	Current int64
+
+	// Total is the expected value of Current when the stage is done, or 0 if it isn't known
+	Total int64
+
+	// BatchSize and BatchDuration describe the most recent batch inserted, if the event relates to one
+	BatchSize     int
+	BatchDuration time.Duration
+
+	// Done is set on the final event for a stage
+	Done bool
+}
+
+// Reporter receives progress events, it is called synchronously so should return quickly
+type Reporter func(Event)
+
+// Discard is a reporter that ignores all events
+func Discard(Event) {}
+
+// Unit returns the unit that Current and Total are measured in for the stage
+func (s Stage) Unit() string {
+	if s == StageDownload {
+		return "bytes"
+	}
+
+	return "rows"
+}
@@ -0,0 +1,140 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// barWidth is the number of characters used for the bar itself
+const barWidth = 30
+
+// DefaultLogInterval is how often progress is logged when not writing to a terminal
+const DefaultLogInterval = 5 * time.Second
+
+// clock lets tests control when periodic log lines are written
+type clock func() time.Time
+
+// NewBarReporter renders a progress bar for each stage to a terminal
+func NewBarReporter(out io.Writer) Reporter {
+	return func(e Event) {
+		fmt.Fprintf(out, "\r\033[K%s", barLine(e))
+		if e.Done {
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+// NewLogReporter logs progress at most once per interval for each stage, plus once when each stage is done
+func NewLogReporter(interval time.Duration) Reporter {
+	return newLogReporter(interval, time.Now)
+}
+
+func newLogReporter(interval time.Duration, now clock) Reporter {
+	lastLogged := make(map[Stage]time.Time)
+
+	return func(e Event) {
+		if !e.Done {
+			last, ok := lastLogged[e.Stage]
+			if !ok {
+				// Start the interval from the first event, rather than logging immediately
+				lastLogged[e.Stage] = now()
+				return
+			}
+
+			if now().Sub(last) < interval {
+				return
+			}
+		}
+
+		lastLogged[e.Stage] = now()
+		logEvent(e)
+	}
+}
+
+func logEvent(e Event) {
+	event := log.Info().
+		Str("stage", string(e.Stage)).
+		Int64("current", e.Current).
+		Bool("done", e.Done)
+
+	if e.Total > 0 {
+		event = event.Int64("total", e.Total)
+	}
+
+	if e.BatchSize > 0 {
+		event = event.Int("batch_size", e.BatchSize).Dur("batch_duration", e.BatchDuration)
+	}
+
+	event.Msg(describe(e))
+}
+
+// describe gives a human readable summary of the event
+func describe(e Event) string {
+	amount := formatAmount(e.Stage, e.Current)
+	if e.Total > 0 {
+		amount = fmt.Sprintf("%s of %s (%d%%)", amount, formatAmount(e.Stage, e.Total), percentage(e))
+	}
+
+	verb := "inserted"
+	if e.Stage == StageDownload {
+		verb = "downloaded"
+	}
+
+	if e.Done {
+		return fmt.Sprintf("%s: finished, %s %s", e.Stage, amount, verb)
+	}
+
+	return fmt.Sprintf("%s: %s %s", e.Stage, amount, verb)
+}
+
+func barLine(e Event) string {
+	if e.Total <= 0 {
+		return describe(e)
+	}
+
+	filled := int(int64(barWidth) * min(e.Current, e.Total) / e.Total)
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+
+	return fmt.Sprintf(
+		"%-8s [%s] %3d%% %s/%s",
+		e.Stage,
+		bar,
+		percentage(e),
+		formatAmount(e.Stage, e.Current),
+		formatAmount(e.Stage, e.Total),
+	)
+}
+
+func percentage(e Event) int64 {
+	if e.Total <= 0 {
+		return 0
+	}
+
+	return 100 * min(e.Current, e.Total) / e.Total
+}
+
+func formatAmount(stage Stage, amount int64) string {
+	if stage.Unit() != "bytes" {
+		return fmt.Sprintf("%d %s", amount, stage.Unit())
+	}
+
+	const unit = 1024
+	if amount < unit {
+		return fmt.Sprintf("%d B", amount)
+	}
+
+	div, exp := int64(unit), 0
+	for n := amount / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(amount)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,95 @@
+package progress
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/test/logging"
+)
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    Event
+		expected string
+	}{
+		{
+			name:     "download with total",
+			event:    Event{Stage: StageDownload, Current: 1536, Total: 3 * 1024 * 1024},
+			expected: "download: 1.5 KiB of 3.0 MiB (0%) downloaded",
+		},
+		{
+			name:     "download without total",
+			event:    Event{Stage: StageDownload, Current: 512},
+			expected: "download: 512 B downloaded",
+		},
+		{
+			name:     "routes in progress",
+			event:    Event{Stage: StageRoutes, Current: 10000, BatchSize: 5000},
+			expected: "routes: 10000 rows inserted",
+		},
+		{
+			name:     "links done",
+			event:    Event{Stage: StageLinks, Current: 200, Total: 200, Done: true},
+			expected: "links: finished, 200 rows of 200 rows (100%) inserted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, describe(tt.event))
+		})
+	}
+}
+
+func TestBarReporter(t *testing.T) {
+	require := require.New(t)
+	out := new(bytes.Buffer)
+	reporter := NewBarReporter(out)
+
+	reporter(Event{Stage: StageLinks, Current: 50, Total: 200})
+	require.Equal("\r\033[Klinks    [=======>                      ]  25% 50 rows/200 rows", out.String())
+
+	out.Reset()
+	reporter(Event{Stage: StageLinks, Current: 200, Total: 200, Done: true})
+	require.Equal("\r\033[Klinks    [==============================] 100% 200 rows/200 rows\n", out.String())
+
+	// Without a total, we can only describe progress
+	out.Reset()
+	reporter(Event{Stage: StageRoutes, Current: 5000})
+	require.Equal("\r\033[Kroutes: 5000 rows inserted", out.String())
+}
+
+func TestLogReporter(t *testing.T) {
+	require := require.New(t)
+	recorder, teardown := logging.HijackLogs()
+	defer teardown()
+
+	now := time.Date(2025, time.January, 23, 0, 0, 0, 0, time.UTC)
+	reporter := newLogReporter(5*time.Second, func() time.Time { return now })
+
+	// The first event starts the interval, so isn't logged
+	reporter(Event{Stage: StageRoutes, Current: 5000, BatchSize: 5000})
+	require.Empty(recorder.Logs())
+
+	// Events inside the interval aren't logged
+	now = now.Add(4 * time.Second)
+	reporter(Event{Stage: StageRoutes, Current: 10000, BatchSize: 5000})
+	require.Empty(recorder.Logs())
+
+	// Once the interval passes, we log
+	now = now.Add(2 * time.Second)
+	reporter(Event{Stage: StageRoutes, Current: 15000, BatchSize: 5000})
+	require.Equal([]string{"routes: 15000 rows inserted"}, recorder.Logs())
+
+	// Other stages have their own interval
+	reporter(Event{Stage: StageLinks, Current: 5000, Total: 6000, BatchSize: 5000})
+	require.Len(recorder.Logs(), 1)
+
+	// Finishing a stage is always logged
+	reporter(Event{Stage: StageLinks, Current: 6000, Total: 6000, Done: true})
+	recorder.AssertHasString(require, "links: finished, 6000 rows of 6000 rows (100%) inserted")
+}
@@ -0,0 +1,115 @@
+package srd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrSuspiciousImport = errors.New("suspicious import, not committed")
+
+// Default thresholds, loose enough that a normal AIRAC change passes but a malformed file doesn't
+const (
+	DefaultMaxErrorPercent = 5.0
+	DefaultMaxDropPercent  = 25.0
+)
+
+// Thresholds are the limits an import must be within to be committed. Percentages are from 0 to 100, and a
+// limit of 100 (or a minimum of 0) turns the check off.
+type Thresholds struct {
+	// The largest share of the rows in the file that may be invalid and skipped
+	MaxRouteErrorPercent float64
+	MaxNoteErrorPercent  float64
+
+	// The largest fall in the number of rows compared to what is currently loaded
+	MaxRouteDropPercent float64
+	MaxNoteDropPercent  float64
+
+	// The fewest rows that may be imported
+	MinRoutes int64
+	MinNotes  int64
+}
+
+// DefaultThresholds returns the thresholds used when none are configured
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		MaxRouteErrorPercent: DefaultMaxErrorPercent,
+		MaxNoteErrorPercent:  DefaultMaxErrorPercent,
+		MaxRouteDropPercent:  DefaultMaxDropPercent,
+		MaxNoteDropPercent:   DefaultMaxDropPercent,
+	}
+}
+
+// Counts are the number of rows in an SRD, and how many of the rows in the file were invalid
+type Counts struct {
+	Routes      int64
+	RouteErrors int64
+	Notes       int64
+	NoteErrors  int64
+}
+
+// SuspiciousImportError is returned when an import breaks its thresholds, giving every reason why
+type SuspiciousImportError struct {
+	Reasons []string
+}
+
+func (e *SuspiciousImportError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrSuspiciousImport, strings.Join(e.Reasons, "; "))
+}
+
+func (e *SuspiciousImportError) Unwrap() error {
+	return ErrSuspiciousImport
+}
+
+// Check compares the rows imported with those currently loaded, returning a SuspiciousImportError if any threshold
+// is broken. Nothing currently loaded, as on the first import, passes the drop checks.
+func (t Thresholds) Check(loaded Counts, imported Counts) error {
+	reasons := make([]string, 0)
+	reasons = appendErrorReason(reasons, "route", imported.Routes, imported.RouteErrors, t.MaxRouteErrorPercent)
+	reasons = appendErrorReason(reasons, "note", imported.Notes, imported.NoteErrors, t.MaxNoteErrorPercent)
+	reasons = appendDropReason(reasons, "route", loaded.Routes, imported.Routes, t.MaxRouteDropPercent)
+	reasons = appendDropReason(reasons, "note", loaded.Notes, imported.Notes, t.MaxNoteDropPercent)
+
+	if imported.Routes < t.MinRoutes {
+		reasons = append(reasons, fmt.Sprintf("only %v routes were imported, below the minimum of %v", imported.Routes, t.MinRoutes))
+	}
+
+	if imported.Notes < t.MinNotes {
+		reasons = append(reasons, fmt.Sprintf("only %v notes were imported, below the minimum of %v", imported.Notes, t.MinNotes))
+	}
+
+	if len(reasons) > 0 {
+		return &SuspiciousImportError{Reasons: reasons}
+	}
+
+	return nil
+}
+
+// appendErrorReason adds a reason if too many of the rows in the file were invalid
+func appendErrorReason(reasons []string, kind string, valid int64, invalid int64, maxPercent float64) []string {
+	total := valid + invalid
+	if total == 0 || maxPercent >= 100 {
+		return reasons
+	}
+
+	percent := float64(invalid) / float64(total) * 100
+	if percent <= maxPercent {
+		return reasons
+	}
+
+	return append(reasons, fmt.Sprintf("%v of %v %v rows (%.1f%%) were invalid, above the maximum of %.1f%%", invalid, total, kind, percent, maxPercent))
+}
+
+// appendDropReason adds a reason if the number of rows has fallen too far from what is currently loaded
+func appendDropReason(reasons []string, kind string, loaded int64, imported int64, maxPercent float64) []string {
+	if loaded == 0 || imported >= loaded || maxPercent >= 100 {
+		return reasons
+	}
+
+	percent := float64(loaded-imported) / float64(loaded) * 100
+	if percent <= maxPercent {
+		return reasons
+	}
+
+	return append(reasons, fmt.Sprintf("%v count fell by %.1f%% from %v to %v, above the maximum of %.1f%%", kind, percent, loaded, imported, maxPercent))
+}
@@ -0,0 +1,87 @@
+package srd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholdsCheck(t *testing.T) {
+	tests := []struct {
+		name            string
+		thresholds      Thresholds
+		loaded          Counts
+		imported        Counts
+		expectedReasons []string
+	}{
+		{
+			name:       "normal import",
+			thresholds: DefaultThresholds(),
+			loaded:     Counts{Routes: 170000, Notes: 900},
+			imported:   Counts{Routes: 168000, RouteErrors: 12, Notes: 905},
+		},
+		{
+			name:       "first import",
+			thresholds: DefaultThresholds(),
+			loaded:     Counts{},
+			imported:   Counts{Routes: 3, Notes: 3},
+		},
+		{
+			name:       "too many invalid routes",
+			thresholds: DefaultThresholds(),
+			imported:   Counts{Routes: 90, RouteErrors: 10, Notes: 3},
+			expectedReasons: []string{
+				"10 of 100 route rows (10.0%) were invalid, above the maximum of 5.0%",
+			},
+		},
+		{
+			name:       "malformed file",
+			thresholds: DefaultThresholds(),
+			loaded:     Counts{Routes: 170000, Notes: 900},
+			imported:   Counts{Routes: 500, RouteErrors: 500, Notes: 0, NoteErrors: 900},
+			expectedReasons: []string{
+				"500 of 1000 route rows (50.0%) were invalid, above the maximum of 5.0%",
+				"900 of 900 note rows (100.0%) were invalid, above the maximum of 5.0%",
+				"route count fell by 99.7% from 170000 to 500, above the maximum of 25.0%",
+				"note count fell by 100.0% from 900 to 0, above the maximum of 25.0%",
+			},
+		},
+		{
+			name:       "below minimum counts",
+			thresholds: Thresholds{MaxRouteErrorPercent: 100, MaxNoteErrorPercent: 100, MaxRouteDropPercent: 100, MaxNoteDropPercent: 100, MinRoutes: 1000, MinNotes: 10},
+			loaded:     Counts{Routes: 170000, Notes: 900},
+			imported:   Counts{Routes: 500, Notes: 5},
+			expectedReasons: []string{
+				"only 500 routes were imported, below the minimum of 1000",
+				"only 5 notes were imported, below the minimum of 10",
+			},
+		},
+		{
+			name:       "checks turned off",
+			thresholds: Thresholds{MaxRouteErrorPercent: 100, MaxNoteErrorPercent: 100, MaxRouteDropPercent: 100, MaxNoteDropPercent: 100},
+			loaded:     Counts{Routes: 170000, Notes: 900},
+			imported:   Counts{Routes: 0, RouteErrors: 1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.thresholds.Check(tt.loaded, tt.imported)
+			if tt.expectedReasons == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrSuspiciousImport)
+
+			var suspiciousErr *SuspiciousImportError
+			require.ErrorAs(t, err, &suspiciousErr)
+			require.Equal(t, tt.expectedReasons, suspiciousErr.Reasons)
+		})
+	}
+}
+
+func TestSuspiciousImportError(t *testing.T) {
+	err := &SuspiciousImportError{Reasons: []string{"first reason", "second reason"}}
+	require.Equal(t, "suspicious import, not committed: first reason; second reason", err.Error())
+}
@@ -6,10 +6,16 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/db"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/file"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/note"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/progress"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/route"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/tracing"
 )
 
 const InsertBatchSize = 5000
@@ -26,17 +32,140 @@ type Import struct {
 
 	// Map of note IDs to route IDs
 	routeNotes map[uint64][]uint64
+
+	// Where to send progress events, and how many rows have been inserted for each stage
+	progress progress.Reporter
+	inserted map[progress.Stage]int64
+
+	// Builds the record of the import that is stored in srd_meta, if set
+	loadedState func() airac.LoadedState
+
+	// How many rows are inserted at a time, and how long to wait between batches
+	batchSize int
+	batchWait time.Duration
+
+	// How the import is retried after a transient database error
+	retry db.RetryPolicy
+
+	// The limits checked before the import is committed, if set, and whether to commit anyway if they're broken
+	thresholds *Thresholds
+	acceptRisk bool
+
+	// How many rows were currently loaded before the import, and how many invalid rows were skipped
+	loaded      Counts
+	routeErrors int64
+	noteErrors  int64
+
+	// References from routes to notes that are missing from the file, and whether they stop the import
+	dangling []note.DanglingReference
+	strict   bool
+}
+
+// Option configures optional behaviour of the Import
+type Option func(*Import)
+
+// WithProgress sets a reporter that receives an event for each batch inserted
+func WithProgress(reporter progress.Reporter) Option {
+	return func(i *Import) {
+		i.progress = reporter
+	}
+}
+
+// WithLoadedState records the loaded cycle in the srd_meta table in the same transaction as the import,
+// so the record can't disagree with the data. The state is built after the data has been inserted, so that it
+// can include counts from the file, and the table must already exist (see db.EnsureMetaTable).
+func WithLoadedState(state func() airac.LoadedState) Option {
+	return func(i *Import) {
+		i.loadedState = state
+	}
+}
+
+// WithBatchSize sets how many rows are inserted at a time, defaulting to InsertBatchSize
+func WithBatchSize(size int) Option {
+	return func(i *Import) {
+		i.batchSize = size
+	}
+}
+
+// WithBatchWait sets how long to wait between batches, defaulting to InterBatchWait
+func WithBatchWait(wait time.Duration) Option {
+	return func(i *Import) {
+		i.batchWait = wait
+	}
+}
+
+// WithRetry sets how the import is retried after a transient database error, defaulting to db.DefaultRetryPolicy
+func WithRetry(policy db.RetryPolicy) Option {
+	return func(i *Import) {
+		i.retry = policy
+	}
 }
 
-func NewImport(file srdFile, db *db.Database) *Import {
-	return &Import{db, file, make(map[uint64][]uint64)}
+// WithThresholds checks the import against the thresholds before it is committed, rolling it back with a
+// SuspiciousImportError if any are broken. If the risk is accepted, the reasons are logged and the import is
+// committed anyway.
+func WithThresholds(thresholds Thresholds, acceptRisk bool) Option {
+	return func(i *Import) {
+		i.thresholds = &thresholds
+		i.acceptRisk = acceptRisk
+	}
+}
+
+// WithStrict rolls the import back with a note.DanglingReferencesError if any route refers to a note that is
+// missing from the file, rather than importing the route without the note
+func WithStrict(strict bool) Option {
+	return func(i *Import) {
+		i.strict = strict
+	}
+}
+
+func NewImport(file srdFile, database *db.Database, opts ...Option) *Import {
+	i := &Import{
+		db:         database,
+		file:       file,
+		routeNotes: make(map[uint64][]uint64),
+		progress:   progress.Discard,
+		inserted:   make(map[progress.Stage]int64),
+		batchSize:  InsertBatchSize,
+		batchWait:  InterBatchWait,
+		retry:      db.DefaultRetryPolicy(),
+	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
 }
 
+// Import replaces the data in the database with the contents of the file, in a single transaction. If the transaction
+// fails with a transient error, such as a deadlock or a dropped connection, the whole import is run again. Nothing is
+// committed until every row has been inserted, so there is no partial import to resume from and each attempt starts
+// from the beginning of the file.
 func (i *Import) Import(ctx context.Context) error {
+	return db.Retry(ctx, i.retry, func() error {
+		return i.importOnce(ctx)
+	})
+}
+
+// importOnce runs a single attempt at the import
+func (i *Import) importOnce(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "import.attempt")
+	defer func() { tracing.End(span, err) }()
+
 	i.routeNotes = make(map[uint64][]uint64)
+	i.inserted = make(map[progress.Stage]int64)
+	i.routeErrors = 0
+	i.noteErrors = 0
+	i.dangling = make([]note.DanglingReference, 0)
 
-	return i.db.Transaction(func(tx *db.Transaction) error {
-		err := i.deleteCurrentData(ctx, tx)
+	return i.db.Transaction(ctx, func(tx *db.Transaction) error {
+		err := i.countLoaded(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		err = i.deleteCurrentData(ctx, tx)
 		if err != nil {
 			return err
 		}
@@ -56,16 +185,38 @@ func (i *Import) Import(ctx context.Context) error {
 			return err
 		}
 
+		err = i.checkDanglingReferences()
+		if err != nil {
+			return err
+		}
+
+		err = i.checkThresholds()
+		if err != nil {
+			return err
+		}
+
+		if i.loadedState != nil {
+			err = tx.SetLoadedState(ctx, i.loadedState())
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 }
 
-// insertNotes inserts the notes into the database, in batches of InsertBatchSize
-func (i *Import) insertNotes(ctx context.Context, tx *db.Transaction) error {
+// insertNotes inserts the notes into the database, in batches of the batch size. The notes are parsed as they are
+// read, so the span of the stage covers parsing them as well as the batches inserted.
+func (i *Import) insertNotes(ctx context.Context, tx *db.Transaction) (err error) {
+	ctx, span := tracing.Start(ctx, "import.notes")
+	defer func() { tracing.End(span, err) }()
+
 	notes := make([]*note.Note, 0)
 	for srdNote, err := range i.file.Notes() {
 		if err != nil {
 			log.Warn().Msgf("invalid note detected: %v", err)
+			i.noteErrors++
 			continue
 		}
 
@@ -76,7 +227,7 @@ func (i *Import) insertNotes(ctx context.Context, tx *db.Transaction) error {
 		i.routeNotes[srdNote.ID()] = make([]uint64, 0)
 
 		// Insert the notes in batches
-		if len(notes) >= InsertBatchSize {
+		if len(notes) >= i.batchSize {
 			err := i.insertNoteBatch(ctx, tx, notes)
 			if err != nil {
 				return err
@@ -94,33 +245,47 @@ func (i *Import) insertNotes(ctx context.Context, tx *db.Transaction) error {
 		}
 	}
 
+	span.SetAttributes(attribute.Int64("rows", i.inserted[progress.StageNotes]), attribute.Int64("invalid_rows", i.noteErrors))
+	i.stageDone(progress.StageNotes, 0)
 	return nil
 }
 
 // insertNoteBatch inserts a batch of notes into the database and then waits for a bit
 func (i *Import) insertNoteBatch(ctx context.Context, tx *db.Transaction, batch []*note.Note) error {
-	if err := tx.InsertNoteBatch(ctx, batch); err != nil {
+	start := time.Now()
+	batchCtx, span := startBatch(ctx, progress.StageNotes, len(batch))
+	err := tx.InsertNoteBatch(batchCtx, batch)
+	tracing.End(span, err)
+	if err != nil {
 		return err
 	}
+	i.batchInserted(progress.StageNotes, len(batch), time.Since(start), 0)
 
 	// Wait for a bit to avoid overwhelming the database
-	i.interBatchWait()
-
-	return nil
+	return i.interBatchWait(ctx)
 }
 
-func (i *Import) insertRoutes(ctx context.Context, tx *db.Transaction) error {
+// insertRoutes inserts the routes into the database, in batches of the batch size. As with notes, the span of the
+// stage covers parsing the routes as well as the batches inserted.
+func (i *Import) insertRoutes(ctx context.Context, tx *db.Transaction) (err error) {
+	ctx, span := tracing.Start(ctx, "import.routes")
+	defer func() { tracing.End(span, err) }()
+
 	routes := make([]*route.Route, 0)
+	row := file.FirstRouteRow - 1
 	for srdRoute, err := range i.file.Routes() {
+		row++
 		if err != nil {
 			log.Warn().Msgf("invalid route detected: %v", err)
+			i.routeErrors++
 			continue
 		}
 
+		i.findDanglingReferences(row, srdRoute)
 		routes = append(routes, srdRoute)
 
 		// Insert the routes in batches
-		if len(routes) >= InsertBatchSize {
+		if len(routes) >= i.batchSize {
 			err := i.insertRouteBatch(ctx, tx, routes)
 			if err != nil {
 				return err
@@ -128,23 +293,35 @@ func (i *Import) insertRoutes(ctx context.Context, tx *db.Transaction) error {
 			routes = make([]*route.Route, 0)
 
 			// Wait for a bit to avoid overwhelming the database
-			i.interBatchWait()
+			err = i.interBatchWait(ctx)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	// Insert any remaining routes
 	if len(routes) > 0 {
-		return i.insertRouteBatch(ctx, tx, routes)
+		err := i.insertRouteBatch(ctx, tx, routes)
+		if err != nil {
+			return err
+		}
 	}
 
+	span.SetAttributes(attribute.Int64("rows", i.inserted[progress.StageRoutes]), attribute.Int64("invalid_rows", i.routeErrors))
+	i.stageDone(progress.StageRoutes, 0)
 	return nil
 }
 
 func (i *Import) insertRouteBatch(ctx context.Context, tx *db.Transaction, batch []*route.Route) error {
-	firstInsertId, err := tx.InsertRouteBatch(ctx, batch)
+	start := time.Now()
+	batchCtx, span := startBatch(ctx, progress.StageRoutes, len(batch))
+	firstInsertId, err := tx.InsertRouteBatch(batchCtx, batch)
+	tracing.End(span, err)
 	if err != nil {
 		return err
 	}
+	i.batchInserted(progress.StageRoutes, len(batch), time.Since(start), 0)
 
 	// Now go through each route in the batch, and add the note IDs to the routeNotes map - the note ID is the firstInsertId + the index
 	for idx, route := range batch {
@@ -152,7 +329,7 @@ func (i *Import) insertRouteBatch(ctx context.Context, tx *db.Transaction, batch
 
 		// Add the note IDs to the routeNotes map
 		for _, noteID := range route.NoteIDs() {
-			// If there's no entry for this note ID, skip it
+			// If there's no entry for this note ID, skip it, it has already been recorded as a dangling reference
 			if _, ok := i.routeNotes[noteID]; !ok {
 				continue
 			}
@@ -162,21 +339,28 @@ func (i *Import) insertRouteBatch(ctx context.Context, tx *db.Transaction, batch
 	}
 
 	// Wait for a bit to avoid overwhelming the database
-	i.interBatchWait()
-
-	return nil
+	return i.interBatchWait(ctx)
 }
 
-// insertNoteRouteLinks inserts the note-route links into the database in batches of InsertBatchSize
-func (i *Import) insertRouteNoteLinks(ctx context.Context, tx *db.Transaction) error {
+// insertNoteRouteLinks inserts the note-route links into the database in batches of the batch size
+func (i *Import) insertRouteNoteLinks(ctx context.Context, tx *db.Transaction) (err error) {
+	ctx, span := tracing.Start(ctx, "import.links")
+	defer func() { tracing.End(span, err) }()
+
+	// We know how many links there are up front, so can report the total
+	var totalLinks int64
+	for _, routeIDs := range i.routeNotes {
+		totalLinks += int64(len(routeIDs))
+	}
+
 	links := make([]*db.NoteRouteLink, 0)
 	for noteID, routeIDs := range i.routeNotes {
 		for _, routeID := range routeIDs {
 			links = append(links, &db.NoteRouteLink{NoteID: noteID, RouteID: routeID})
 
 			// Insert the links in batches
-			if len(links) >= InsertBatchSize {
-				err := i.insertRouteNoteBatch(ctx, tx, links)
+			if len(links) >= i.batchSize {
+				err := i.insertRouteNoteBatch(ctx, tx, links, totalLinks)
 				if err != nil {
 					return err
 				}
@@ -187,21 +371,100 @@ func (i *Import) insertRouteNoteLinks(ctx context.Context, tx *db.Transaction) e
 
 	// Insert any remaining links
 	if len(links) > 0 {
-		return i.insertRouteNoteBatch(ctx, tx, links)
+		err := i.insertRouteNoteBatch(ctx, tx, links, totalLinks)
+		if err != nil {
+			return err
+		}
 	}
 
+	span.SetAttributes(attribute.Int64("rows", i.inserted[progress.StageLinks]))
+	i.stageDone(progress.StageLinks, totalLinks)
 	return nil
 }
 
 // insertRouteNoteBatch inserts a batch of note-route links into the database and then waits for a bit
-func (i *Import) insertRouteNoteBatch(ctx context.Context, tx *db.Transaction, batch []*db.NoteRouteLink) error {
-	if err := tx.InsertNoteRouteLinkBatch(ctx, batch); err != nil {
+func (i *Import) insertRouteNoteBatch(ctx context.Context, tx *db.Transaction, batch []*db.NoteRouteLink, totalLinks int64) error {
+	start := time.Now()
+	batchCtx, span := startBatch(ctx, progress.StageLinks, len(batch))
+	err := tx.InsertNoteRouteLinkBatch(batchCtx, batch)
+	tracing.End(span, err)
+	if err != nil {
 		return err
 	}
+	i.batchInserted(progress.StageLinks, len(batch), time.Since(start), totalLinks)
 
 	// Wait for a bit to avoid overwhelming the database
-	i.interBatchWait()
+	return i.interBatchWait(ctx)
+}
+
+// findDanglingReferences records the notes a route refers to that aren't in the file, the notes must have been
+// inserted already
+func (i *Import) findDanglingReferences(row int, srdRoute *route.Route) {
+	for _, noteID := range srdRoute.NoteIDs() {
+		if _, ok := i.routeNotes[noteID]; ok {
+			continue
+		}
+
+		reference := note.DanglingReference{Row: row, Origin: srdRoute.ADEPOrEntry(), Destination: srdRoute.ADESOrExit(), NoteID: noteID}
+		log.Warn().Int("row", row).Uint64("note_id", noteID).Msgf("dangling note reference detected: %v", reference)
+		i.dangling = append(i.dangling, reference)
+	}
+}
+
+// checkDanglingReferences fails the import in strict mode if any routes refer to missing notes
+func (i *Import) checkDanglingReferences() error {
+	if len(i.dangling) == 0 || !i.strict {
+		return nil
+	}
+
+	return &note.DanglingReferencesError{References: i.dangling}
+}
+
+// DanglingReferences returns the references from routes to notes that were missing from the file, in the last
+// attempt at the import
+func (i *Import) DanglingReferences() []note.DanglingReference {
+	return i.dangling
+}
+
+// countLoaded records how many rows are currently loaded, for the thresholds to compare the import with
+func (i *Import) countLoaded(ctx context.Context, tx *db.Transaction) error {
+	if i.thresholds == nil {
+		return nil
+	}
+
+	routes, err := tx.CountRoutes(ctx)
+	if err != nil {
+		return err
+	}
+
+	notes, err := tx.CountNotes(ctx)
+	if err != nil {
+		return err
+	}
+
+	i.loaded = Counts{Routes: routes, Notes: notes}
+	return nil
+}
+
+// checkThresholds checks the rows inserted against the thresholds, if there are any
+func (i *Import) checkThresholds() error {
+	if i.thresholds == nil {
+		return nil
+	}
 
+	imported := Counts{
+		Routes:      i.inserted[progress.StageRoutes],
+		RouteErrors: i.routeErrors,
+		Notes:       i.inserted[progress.StageNotes],
+		NoteErrors:  i.noteErrors,
+	}
+
+	err := i.thresholds.Check(i.loaded, imported)
+	if err == nil || !i.acceptRisk {
+		return err
+	}
+
+	log.Warn().Msgf("committing the import anyway as the risk was accepted: %v", err)
 	return nil
 }
 
@@ -214,7 +477,40 @@ func (i *Import) deleteCurrentData(ctx context.Context, tx *db.Transaction) erro
 	return tx.DeleteAllNotes(ctx)
 }
 
-// If we import too quickly, we might overwhelm the database, so we should wait between batches
-func (i *Import) interBatchWait() {
-	time.Sleep(InterBatchWait)
+// startBatch starts the span of inserting a batch of rows for a stage
+func startBatch(ctx context.Context, stage progress.Stage, size int) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "import.batch", attribute.String("stage", string(stage)), attribute.Int("rows", size))
+}
+
+// batchInserted records that a batch has been inserted and reports the progress of the stage
+func (i *Import) batchInserted(stage progress.Stage, size int, duration time.Duration, total int64) {
+	i.inserted[stage] += int64(size)
+	log.Debug().Str("stage", string(stage)).Int("count", size).Dur("duration", duration).Msgf("inserted batch of %v %v in %v", size, stage, duration)
+
+	i.progress(progress.Event{
+		Stage:         stage,
+		Current:       i.inserted[stage],
+		Total:         total,
+		BatchSize:     size,
+		BatchDuration: duration,
+	})
+}
+
+// stageDone reports that all of the rows for a stage have been inserted
+func (i *Import) stageDone(stage progress.Stage, total int64) {
+	i.progress(progress.Event{Stage: stage, Current: i.inserted[stage], Total: total, Done: true})
+}
+
+// If we import too quickly, we might overwhelm the database, so we should wait between batches.
+// The wait is cut short if the context is cancelled, returning its error.
+func (i *Import) interBatchWait(ctx context.Context) error {
+	timer := time.NewTimer(i.batchWait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
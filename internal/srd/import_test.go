@@ -8,16 +8,18 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go/modules/mysql"
 
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/airac"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/db"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/excel"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/file"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/note"
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/progress"
 	"github.com/VATSIM-UK/ukcp-srd-tools/internal/route"
 )
 
@@ -57,12 +59,37 @@ func getMysqlContainer(ctx context.Context, t testingT) (*mysqlContainer, error)
 	return &mysqlContainer{container, terminateFunc}, nil
 }
 
-func TestImport_Successful(t *testing.T) {
+// newTestDatabase starts a MySQL container and connects to it, both are cleaned up when the test finishes
+func newTestDatabase(t testing.TB) *db.Database {
 	ctx := context.Background()
 	require := require.New(t)
 	container, err := getMysqlContainer(ctx, t)
 	require.NoError(err)
-	defer container.terminateFunc()
+	t.Cleanup(container.terminateFunc)
+
+	containerHost, err := container.container.Host(ctx)
+	require.NoError(err)
+	containerPort, err := container.container.MappedPort(ctx, "3306/tcp")
+	require.NoError(err)
+
+	database, err := db.NewDatabase(db.DatabaseConnectionParams{
+		Host:     containerHost,
+		Port:     containerPort.Int(),
+		Username: TestUsername,
+		Password: TestPassword,
+		Database: TestDatabase,
+	})
+	require.NoError(err)
+	t.Cleanup(func() {
+		database.Close()
+	})
+
+	return database
+}
+
+func TestImport_Successful(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
 
 	// Create a fake SRD file
 	mockSrdFile := &mockSrdFile{
@@ -98,31 +125,28 @@ func TestImport_Successful(t *testing.T) {
 		},
 	}
 
-	containerHost, err := container.container.Host(ctx)
-	containerInspect, err := container.container.Inspect(ctx)
-	containerPort := containerInspect.NetworkSettings.Ports["3306/tcp"][0].HostPort
-	// Convert port to int
-	containerPortInt, err := strconv.Atoi(containerPort)
-	require.NoError(err)
-
-	// Create db
-	db, err := db.NewDatabase(db.DatabaseConnectionParams{
-		Host:     containerHost,
-		Port:     containerPortInt,
-		Username: TestUsername,
-		Password: TestPassword,
-		Database: TestDatabase,
-	})
-	require.NoError(err)
+	db := newTestDatabase(t)
 
-	defer db.Close()
+	// Create the importer and go, recording the progress
+	events := make([]progress.Event, 0)
+	importer := NewImport(mockSrdFile, db, WithProgress(func(e progress.Event) {
+		e.BatchDuration = 0
+		events = append(events, e)
+	}))
 
-	// Create the importer and go
-	importer := NewImport(mockSrdFile, db)
-
-	err = importer.Import(ctx)
+	err := importer.Import(ctx)
 	require.NoError(err)
 
+	// Check the progress events, one batch per stage and then done
+	require.Equal([]progress.Event{
+		{Stage: progress.StageNotes, Current: 3, BatchSize: 3},
+		{Stage: progress.StageNotes, Current: 3, Done: true},
+		{Stage: progress.StageRoutes, Current: 3, BatchSize: 3},
+		{Stage: progress.StageRoutes, Current: 3, Done: true},
+		{Stage: progress.StageLinks, Current: 3, Total: 3, BatchSize: 3},
+		{Stage: progress.StageLinks, Current: 3, Total: 3, Done: true},
+	}, events)
+
 	// Check we have the notes in the database
 	dbHandle := db.Handle()
 
@@ -186,12 +210,203 @@ func TestImport_Successful(t *testing.T) {
 	require.Equal("3", allMappings[2].note)
 }
 
-func TestImport_ErrornousRoutes(t *testing.T) {
+func TestImport_RecordsLoadedState(t *testing.T) {
 	ctx := context.Background()
 	require := require.New(t)
-	container, err := getMysqlContainer(ctx, t)
+
+	mockSrdFile := &mockSrdFile{
+		notes: srdNoteList{
+			{
+				note: note.NewNote(1, "Note 1 Text"),
+				err:  nil,
+			},
+		},
+		routes: srdRouteList{
+			{
+				route: route.NewRoute("EGLL", ptr("SID1"), ptr(uint64(35000)), ptr(uint64(37000)), "SEGMENT", ptr("STAR1"), "EGKK", []uint64{1}),
+				err:   nil,
+			},
+		},
+	}
+
+	db := newTestDatabase(t)
+
+	// Without the table, nothing is recorded
+	_, found, err := db.LoadedState(ctx)
+	require.NoError(err)
+	require.False(found)
+
+	require.NoError(db.EnsureMetaTable(ctx))
+	_, found, err = db.LoadedState(ctx)
+	require.NoError(err)
+	require.False(found)
+
+	// Import, recording the state
+	state := airac.LoadedState{
+		Ident:          "2501",
+		ImportedAt:     time.Date(2025, time.January, 23, 1, 2, 3, 0, time.UTC),
+		SourceFile:     "/tmp/srd.xlsx",
+		SourceChecksum: "abc123",
+		RouteCount:     1,
+		NoteCount:      1,
+		ToolVersion:    "v1.2.3",
+	}
+	importer := NewImport(mockSrdFile, db, WithLoadedState(func() airac.LoadedState {
+		return state
+	}))
+
+	err = importer.Import(ctx)
+	require.NoError(err)
+
+	actual, found, err := db.LoadedState(ctx)
+	require.NoError(err)
+	require.True(found)
+	require.Equal(state, actual)
+
+	// Importing again replaces the record
+	state.Ident = "2502"
+	err = importer.Import(ctx)
+	require.NoError(err)
+
+	actual, found, err = db.LoadedState(ctx)
+	require.NoError(err)
+	require.True(found)
+	require.Equal("2502", actual.Ident)
+}
+
+func TestImport_CancelledRollsBack(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	existing := &mockSrdFile{
+		notes: srdNoteList{
+			{
+				note: note.NewNote(1, "Note 1 Text"),
+				err:  nil,
+			},
+		},
+		routes: srdRouteList{
+			{
+				route: route.NewRoute("EGLL", ptr("SID1"), ptr(uint64(35000)), ptr(uint64(37000)), "SEGMENT", ptr("STAR1"), "EGKK", []uint64{1}),
+				err:   nil,
+			},
+		},
+	}
+
+	db := newTestDatabase(t)
+
+	// Load some existing data
+	err := NewImport(existing, db).Import(ctx)
+	require.NoError(err)
+
+	// Cancel the next import once the notes have been replaced
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	replacement := &mockSrdFile{
+		notes: srdNoteList{
+			{
+				note: note.NewNote(2, "Note 2 Text"),
+				err:  nil,
+			},
+		},
+	}
+	importer := NewImport(replacement, db, WithProgress(func(event progress.Event) {
+		if event.Stage == progress.StageNotes {
+			cancel()
+		}
+	}))
+
+	start := time.Now()
+	err = importer.Import(cancelCtx)
+	require.ErrorIs(err, context.Canceled)
+
+	// The wait between batches is cut short
+	require.Less(time.Since(start), InterBatchWait)
+
+	// The existing data is untouched
+	dbHandle := db.Handle()
+	noteRows := allNotes(ctx, require, dbHandle)
+	require.Len(noteRows, 1)
+	require.Equal("1", noteRows[0].id)
+	require.Len(allRoutes(ctx, require, dbHandle), 1)
+	require.Len(allRouteNoteLinks(ctx, require, dbHandle), 1)
+}
+
+func TestImport_SuspiciousImportRolledBack(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	existing := &mockSrdFile{
+		notes: srdNoteList{
+			{
+				note: note.NewNote(1, "Note 1 Text"),
+				err:  nil,
+			},
+		},
+		routes: srdRouteList{
+			{
+				route: route.NewRoute("EGLL", ptr("SID1"), ptr(uint64(35000)), ptr(uint64(37000)), "SEGMENT", ptr("STAR1"), "EGKK", []uint64{1}),
+				err:   nil,
+			},
+			{
+				route: route.NewRoute("EGGD", nil, ptr(uint64(37000)), ptr(uint64(39000)), "SEGMENT", nil, "EGLL", []uint64{}),
+				err:   nil,
+			},
+		},
+	}
+
+	db := newTestDatabase(t)
+
+	// Load some existing data
+	err := NewImport(existing, db, WithThresholds(DefaultThresholds(), false)).Import(ctx)
 	require.NoError(err)
-	defer container.terminateFunc()
+
+	// A file where most of the routes are invalid
+	malformed := &mockSrdFile{
+		notes: srdNoteList{
+			{
+				note: note.NewNote(2, "Note 2 Text"),
+				err:  nil,
+			},
+		},
+		routes: srdRouteList{
+			{
+				route: route.NewRoute("EGKK", nil, ptr(uint64(35000)), ptr(uint64(37000)), "SEGMENT", nil, "EGLL", []uint64{}),
+				err:   nil,
+			},
+			{
+				route: nil,
+				err:   errors.New("foo"),
+			},
+		},
+	}
+
+	err = NewImport(malformed, db, WithThresholds(DefaultThresholds(), false)).Import(ctx)
+	require.ErrorIs(err, ErrSuspiciousImport)
+	require.ErrorContains(err, "1 of 2 route rows (50.0%) were invalid")
+	require.ErrorContains(err, "route count fell by 50.0% from 2 to 1")
+
+	// The existing data is untouched
+	dbHandle := db.Handle()
+	noteRows := allNotes(ctx, require, dbHandle)
+	require.Len(noteRows, 1)
+	require.Equal("1", noteRows[0].id)
+	require.Len(allRoutes(ctx, require, dbHandle), 2)
+
+	// Unless the risk is accepted
+	err = NewImport(malformed, db, WithThresholds(DefaultThresholds(), true)).Import(ctx)
+	require.NoError(err)
+
+	noteRows = allNotes(ctx, require, dbHandle)
+	require.Len(noteRows, 1)
+	require.Equal("2", noteRows[0].id)
+	require.Len(allRoutes(ctx, require, dbHandle), 1)
+}
+
+func TestImport_ErrornousRoutes(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
 
 	// Create a fake SRD file
 	mockSrdFile := &mockSrdFile{
@@ -226,29 +441,12 @@ func TestImport_ErrornousRoutes(t *testing.T) {
 		},
 	}
 
-	containerHost, err := container.container.Host(ctx)
-	containerInspect, err := container.container.Inspect(ctx)
-	containerPort := containerInspect.NetworkSettings.Ports["3306/tcp"][0].HostPort
-	// Convert port to int
-	containerPortInt, err := strconv.Atoi(containerPort)
-	require.NoError(err)
-
-	// Create db
-	db, err := db.NewDatabase(db.DatabaseConnectionParams{
-		Host:     containerHost,
-		Port:     containerPortInt,
-		Username: TestUsername,
-		Password: TestPassword,
-		Database: TestDatabase,
-	})
-	require.NoError(err)
-
-	defer db.Close()
+	db := newTestDatabase(t)
 
 	// Create the importer and go
 	importer := NewImport(mockSrdFile, db)
 
-	err = importer.Import(ctx)
+	err := importer.Import(ctx)
 	require.NoError(err)
 
 	// Check we have the notes in the database
@@ -306,9 +504,6 @@ func TestImport_ErrornousRoutes(t *testing.T) {
 func TestImport_ErroneousNotes(t *testing.T) {
 	ctx := context.Background()
 	require := require.New(t)
-	container, err := getMysqlContainer(ctx, t)
-	require.NoError(err)
-	defer container.terminateFunc()
 
 	// Create a fake SRD file
 	mockSrdFile := &mockSrdFile{
@@ -348,29 +543,12 @@ func TestImport_ErroneousNotes(t *testing.T) {
 		},
 	}
 
-	containerHost, err := container.container.Host(ctx)
-	containerInspect, err := container.container.Inspect(ctx)
-	containerPort := containerInspect.NetworkSettings.Ports["3306/tcp"][0].HostPort
-	// Convert port to int
-	containerPortInt, err := strconv.Atoi(containerPort)
-	require.NoError(err)
-
-	// Create db
-	db, err := db.NewDatabase(db.DatabaseConnectionParams{
-		Host:     containerHost,
-		Port:     containerPortInt,
-		Username: TestUsername,
-		Password: TestPassword,
-		Database: TestDatabase,
-	})
-	require.NoError(err)
-
-	defer db.Close()
+	db := newTestDatabase(t)
 
 	// Create the importer and go
 	importer := NewImport(mockSrdFile, db)
 
-	err = importer.Import(ctx)
+	err := importer.Import(ctx)
 	require.NoError(err)
 
 	// Check we have the notes in the database
@@ -439,9 +617,6 @@ func TestImport_ErroneousNotes(t *testing.T) {
 func TestImport_BadRouteNoteLinks(t *testing.T) {
 	ctx := context.Background()
 	require := require.New(t)
-	container, err := getMysqlContainer(ctx, t)
-	require.NoError(err)
-	defer container.terminateFunc()
 
 	// Create a fake SRD file
 	mockSrdFile := &mockSrdFile{
@@ -481,29 +656,12 @@ func TestImport_BadRouteNoteLinks(t *testing.T) {
 		},
 	}
 
-	containerHost, err := container.container.Host(ctx)
-	containerInspect, err := container.container.Inspect(ctx)
-	containerPort := containerInspect.NetworkSettings.Ports["3306/tcp"][0].HostPort
-	// Convert port to int
-	containerPortInt, err := strconv.Atoi(containerPort)
-	require.NoError(err)
-
-	// Create db
-	db, err := db.NewDatabase(db.DatabaseConnectionParams{
-		Host:     containerHost,
-		Port:     containerPortInt,
-		Username: TestUsername,
-		Password: TestPassword,
-		Database: TestDatabase,
-	})
-	require.NoError(err)
-
-	defer db.Close()
+	db := newTestDatabase(t)
 
 	// Create the importer and go
 	importer := NewImport(mockSrdFile, db)
 
-	err = importer.Import(ctx)
+	err := importer.Import(ctx)
 	require.NoError(err)
 
 	// Check we have the notes in the database
@@ -567,33 +725,39 @@ func TestImport_BadRouteNoteLinks(t *testing.T) {
 	require.Equal("2", allMappings[1].note)
 	require.Equal(routeRows[1].id, allMappings[2].route)
 	require.Equal("3", allMappings[2].note)
+
+	// The missing notes are reported
+	require.Equal([]note.DanglingReference{
+		{Row: 2, Origin: "EGLL", Destination: "EGKK", NoteID: 55},
+		{Row: 4, Origin: "EGGD", Destination: "EGLL", NoteID: 24},
+	}, importer.DanglingReferences())
+
+	// In strict mode, the import is rolled back instead
+	mockSrdFile.notes = srdNoteList{
+		{
+			note: note.NewNote(4, "Note 4 Text"),
+			err:  nil,
+		},
+	}
+	mockSrdFile.routes = srdRouteList{
+		{
+			route: route.NewRoute("EGCC", nil, ptr(uint64(35000)), ptr(uint64(37000)), "SEGMENT", nil, "EGLL", []uint64{4, 5}),
+			err:   nil,
+		},
+	}
+
+	err = NewImport(mockSrdFile, db, WithStrict(true)).Import(ctx)
+	require.ErrorIs(err, note.ErrDanglingReferences)
+	require.ErrorContains(err, "route on row 2 (EGCC to EGLL) refers to missing note 5")
+	require.Len(allNotes(ctx, require, dbHandle), 3)
+	require.Len(allRoutes(ctx, require, dbHandle), 3)
 }
 
 func BenchmarkImport(b *testing.B) {
 	ctx := context.Background()
 	require := require.New(b)
-	container, err := getMysqlContainer(ctx, b)
-	require.NoError(err)
-	defer container.terminateFunc()
 
-	containerHost, err := container.container.Host(ctx)
-	containerInspect, err := container.container.Inspect(ctx)
-	containerPort := containerInspect.NetworkSettings.Ports["3306/tcp"][0].HostPort
-	// Convert port to int
-	containerPortInt, err := strconv.Atoi(containerPort)
-	require.NoError(err)
-
-	// Create db
-	db, err := db.NewDatabase(db.DatabaseConnectionParams{
-		Host:     containerHost,
-		Port:     containerPortInt,
-		Username: TestUsername,
-		Password: TestPassword,
-		Database: TestDatabase,
-	})
-	require.NoError(err)
-
-	defer db.Close()
+	db := newTestDatabase(b)
 
 	// Reset the benchmark timer
 	b.ResetTimer()
@@ -603,7 +767,7 @@ func BenchmarkImport(b *testing.B) {
 		path, _ := filepath.Abs("../../test/srd/test.xls")
 
 		// Check if the file exists
-		_, err = os.Stat(path)
+		_, err := os.Stat(path)
 		require.NoError(err)
 
 		// Get the heap allocated right now
@@ -635,28 +799,8 @@ func BenchmarkImport(b *testing.B) {
 func BenchmarkImportXlsx(b *testing.B) {
 	ctx := context.Background()
 	require := require.New(b)
-	container, err := getMysqlContainer(ctx, b)
-	require.NoError(err)
-	defer container.terminateFunc()
-
-	containerHost, err := container.container.Host(ctx)
-	containerInspect, err := container.container.Inspect(ctx)
-	containerPort := containerInspect.NetworkSettings.Ports["3306/tcp"][0].HostPort
-	// Convert port to int
-	containerPortInt, err := strconv.Atoi(containerPort)
-	require.NoError(err)
-
-	// Create db
-	db, err := db.NewDatabase(db.DatabaseConnectionParams{
-		Host:     containerHost,
-		Port:     containerPortInt,
-		Username: TestUsername,
-		Password: TestPassword,
-		Database: TestDatabase,
-	})
-	require.NoError(err)
 
-	defer db.Close()
+	db := newTestDatabase(b)
 
 	// Reset the benchmark timer
 	b.ResetTimer()
@@ -666,7 +810,7 @@ func BenchmarkImportXlsx(b *testing.B) {
 		path, _ := filepath.Abs("../../test/srd/test.xlsx")
 
 		// Check if the file exists
-		_, err = os.Stat(path)
+		_, err := os.Stat(path)
 		require.NoError(err)
 
 		// Get the heap allocated right now
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/VATSIM-UK/ukcp-srd-tools/internal/version"
+)
+
+// TracerName identifies the spans created by this module
+const TracerName = "github.com/VATSIM-UK/ukcp-srd-tools"
+
+// ServiceName is the service that traces are reported as coming from
+const ServiceName = "ukcp-srd-tools"
+
+var ErrInvalidEndpoint = errors.New("invalid OTLP endpoint")
+
+// Setup sends spans to the OTLP/HTTP endpoint, such as http://localhost:4318, in batches. The other
+// OTEL_EXPORTER_OTLP_* environment variables, such as the headers, are respected. Until Setup is called spans are
+// not recorded, so tracing costs next to nothing when it isn't in use. The function returned flushes any spans that
+// haven't been sent yet and stops sending them.
+func Setup(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidEndpoint, endpoint, err)
+	}
+
+	return setProvider(sdktrace.WithBatcher(exporter)), nil
+}
+
+// SetupExporter sends each span to the exporter as soon as it ends, such as a tracetest.InMemoryExporter in tests
+func SetupExporter(exporter sdktrace.SpanExporter) func(context.Context) error {
+	return setProvider(sdktrace.WithSyncer(exporter))
+}
+
+func setProvider(processor sdktrace.TracerProviderOption) func(context.Context) error {
+	provider := sdktrace.NewTracerProvider(
+		processor,
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(ServiceName),
+			semconv.ServiceVersion(version.String()),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown
+}
+
+// Start starts a span, which is a child of any span in the context
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends a span, marking it as failed if there was an error
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
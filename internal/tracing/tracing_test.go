@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartAndEnd(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown := SetupExporter(exporter)
+	defer shutdown(context.Background())
+
+	ctx, parent := Start(context.Background(), "import", attribute.String("cycle", "2601"))
+	_, child := Start(ctx, "import.batch")
+	End(child, errors.New("deadlock"))
+	End(parent, nil)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	// Spans are exported as they end, so the child comes first
+	require.Equal(t, "import.batch", spans[0].Name)
+	require.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	require.Equal(t, codes.Error, spans[0].Status.Code)
+	require.Equal(t, "deadlock", spans[0].Status.Description)
+	require.Len(t, spans[0].Events, 1)
+
+	require.Equal(t, "import", spans[1].Name)
+	require.Equal(t, codes.Unset, spans[1].Status.Code)
+	require.Equal(t, []attribute.KeyValue{attribute.String("cycle", "2601")}, spans[1].Attributes)
+	require.Contains(t, spans[1].Resource.Attributes(), attribute.String("service.name", ServiceName))
+}
+
+func TestSetup(t *testing.T) {
+	// A stub OTLP receiver, recording where spans were sent
+	requests := make(chan *http.Request, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	defer receiver.Close()
+
+	shutdown, err := Setup(context.Background(), receiver.URL)
+	require.NoError(t, err)
+
+	_, span := Start(context.Background(), "download")
+	End(span, nil)
+
+	// Spans are sent in batches, shutting down sends the last of them
+	require.NoError(t, shutdown(context.Background()))
+	require.Len(t, requests, 1)
+
+	request := <-requests
+	require.Equal(t, http.MethodPost, request.Method)
+	require.Equal(t, "/v1/traces", request.URL.Path)
+	require.Equal(t, "application/x-protobuf", request.Header.Get("Content-Type"))
+}
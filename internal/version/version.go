@@ -0,0 +1,22 @@
+package version
+
+import (
+	"runtime/debug"
+)
+
+// Version is set when building a release, using:
+// -ldflags "-X github.com/VATSIM-UK/ukcp-srd-tools/internal/version.Version=v1.2.3"
+var Version = ""
+
+// String returns the version of the tool, falling back to the module version from the build info, or "dev"
+func String() string {
+	if Version != "" {
+		return Version
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	return "dev"
+}
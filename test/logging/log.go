@@ -47,3 +47,8 @@ func HijackLogs() (*LogRecorder, func()) {
 		log.Logger = previousLogger
 	}
 }
+
+// Logs returns the messages that have been logged
+func (l *LogRecorder) Logs() []string {
+	return l.logs
+}